@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/dave/dst"
+
+	"github.com/zhiqiangxu/gg/pkg/generic"
+	"github.com/zhiqiangxu/gg/pkg/globals"
+)
+
+var (
+	// ErrCombineTests when -tests is used for a fan-out into one output
+	ErrCombineTests = errors.New("-tests can't be used for a fan-out into one output")
+	// ErrNameCollision when a global is declared more than once in a combined output
+	ErrNameCollision = errors.New("name collision in combined output")
+	// ErrCombineGeneric when a fan-out of a generic template goes into one output
+	ErrCombineGeneric = errors.New("a fan-out of a generic template can't go into one output, use a pattern for -o")
+)
+
+// sameOutput tells whether all instances of a fan-out go to one output
+func sameOutput(insts []*instance) bool {
+	for _, one := range insts {
+		if one.Output != insts[0].Output {
+			return false
+		}
+	}
+	return len(insts) > 1
+}
+
+// defaultNamePattern appends the replacement of each placeholder to the name, e.g. NewKeySetString
+func defaultNamePattern(types map[string]string) string {
+	placeholders := make([]string, 0, len(types))
+	for name := range types {
+		placeholders = append(placeholders, name)
+	}
+	sort.Strings(placeholders)
+
+	pattern := "{{.Name}}"
+	for _, name := range placeholders {
+		pattern += fmt.Sprintf("{{index . %q|word|title}}", name)
+	}
+	return pattern
+}
+
+// renderCombined instantiates all instances of a fan-out into one output. Declarations not depending
+// on any replaced type, directly or through other declarations, are emitted once, the others are
+// renamed per instance with the name pattern unless renamed by -d.
+func renderCombined(inst *instance, insts []*instance) (files []outputFile, err error) {
+	if inst.Tests {
+		err = ErrCombineTests
+		return
+	}
+
+	pt, err := parseTemplate(inst.Inputs)
+	if err != nil {
+		return
+	}
+	if generic.IsGeneric(pt.df) {
+		err = ErrCombineGeneric
+		return
+	}
+
+	// placeholders replaced, and globals renamed or reassigned, differently per instance
+	seeds := make(map[string]bool)
+	for _, one := range insts {
+		for name, v := range one.Types {
+			if v != insts[0].Types[name] {
+				seeds[name] = true
+			}
+		}
+		for name, v := range one.Declares {
+			if v != insts[0].Declares[name] {
+				seeds[name] = true
+			}
+		}
+		for name, v := range one.Consts {
+			if v != insts[0].Consts[name] {
+				seeds[name] = true
+			}
+		}
+		// a member renamed differently makes its type differ
+		for key, v := range one.Methods {
+			if v != insts[0].Methods[key] {
+				seeds[strings.SplitN(key, ".", 2)[0]] = true
+			}
+		}
+		for key, v := range one.Fields {
+			if v != insts[0].Fields[key] {
+				seeds[strings.SplitN(key, ".", 2)[0]] = true
+			}
+		}
+	}
+	units := globals.Units(pt.df)
+	deps := globals.Dependents(units, seeds)
+	dependents := make(map[token.Position]bool)
+	for u := range deps {
+		dependents[pt.pos(u.Node)] = true
+	}
+
+	var (
+		combined  *dst.File
+		positions []func(dst.Node) token.Position
+	)
+	for i, one := range insts {
+		// names are decided here, so that those shared are named once
+		each := *one
+		each.TypeCheck = false
+		each.NamePattern, each.KindPatterns = "", nil
+		each.Declares = make(map[string]string)
+		for k, v := range one.Declares {
+			each.Declares[k] = v
+		}
+		for _, u := range units {
+			// dependents are named per instance, by default with each replacement appended
+			types, pattern := insts[0].Types, inst.namePattern(u.Kind)
+			if deps[u] {
+				types = one.Types
+				if pattern == "" {
+					pattern = defaultNamePattern(one.Types)
+				}
+			}
+			if pattern == "" {
+				continue
+			}
+			for _, name := range u.Names {
+				if _, ok := one.Types[name]; ok {
+					continue
+				}
+				if _, ok := each.Declares[name]; ok {
+					continue
+				}
+				if each.Declares[name], err = expandName(pattern, name, u.Kind, types); err != nil {
+					return
+				}
+			}
+		}
+
+		var (
+			df  *dst.File
+			pos func(dst.Node) token.Position
+		)
+		df, pos, err = instantiate(&each, each.Inputs)
+		if err != nil {
+			return
+		}
+		positions = append(positions, pos)
+		if i == 0 {
+			combined = df
+			continue
+		}
+
+		// imports of later instances are added if missing
+		have := make(map[string]bool)
+		for _, path := range globals.GetImportMapDst(combined) {
+			have[path] = true
+		}
+		missing := make(map[string]string)
+		for name, path := range globals.GetImportMapDst(df) {
+			if !have[path] {
+				missing[name] = path
+			}
+		}
+		if len(missing) > 0 {
+			globals.AddImports(combined, missing)
+		}
+
+		// only the dependent declarations
+		for _, d := range df.Decls {
+			switch x := d.(type) {
+			case *dst.GenDecl:
+				if x.Tok == token.IMPORT {
+					continue
+				}
+				if x.Tok == token.TYPE {
+					var specs []dst.Spec
+					for _, s := range x.Specs {
+						if dependents[pos(s)] {
+							specs = append(specs, s)
+						}
+					}
+					if len(specs) == 0 {
+						continue
+					}
+					x.Specs = specs
+				} else if !dependents[pos(x)] {
+					continue
+				}
+			case *dst.FuncDecl:
+				if !dependents[pos(x)] {
+					continue
+				}
+			}
+			combined.Decls = append(combined.Decls, d)
+		}
+	}
+	globals.OrganizeImports(combined)
+
+	// what's left to the users, e.g. -d without a pattern for a dependent declaration
+	seen := make(map[string]bool)
+	var dups []string
+	globals.WalkGlobalsDst(combined, func(name string, kind globals.SymKind) bool {
+		if kind != globals.KindImport {
+			if seen[name] {
+				dups = append(dups, name)
+			}
+			seen[name] = true
+		}
+		return true
+	})
+	if len(dups) > 0 {
+		err = fmt.Errorf("%v: %s declared more than once, use -d or -name with patterns depending on the types", ErrNameCollision, strings.Join(dups, ", "))
+		return
+	}
+
+	if inst.TypeCheck {
+		err = typeCheck(inst, combined, func(n dst.Node) (p token.Position) {
+			for _, pos := range positions {
+				if p = pos(n); p.IsValid() {
+					return
+				}
+			}
+			return
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	h, err := header(inst)
+	if err != nil {
+		return
+	}
+	content, err := formatFile(h, combined)
+	if err != nil {
+		return
+	}
+	files = append(files, outputFile{Path: inst.Output, Content: content})
+	return
+}
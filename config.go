@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/zhiqiangxu/util/logger"
+)
+
+// manifest lists many instantiations to be run in one process, e.g.
+//
+//	instances:
+//	  - name: stringset
+//	    inputs: [example/container/set/set.go]
+//	    types: {Type: string}
+//	    declares: {Set: StringSet, NewSet: NewStringSet}
+//	    output: stringset.go
+//
+// Relative paths are relative to the directory of the manifest.
+type manifest struct {
+	Instances []*instance `json:"instances" yaml:"instances"`
+}
+
+// loadManifest reads a manifest in yaml, or json if the file ends with .json, unknown keys are errors
+func loadManifest(path string) (m *manifest, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	// unknown keys are errors, e.g. check which is typecheck now, rather than silently ignored
+	m = &manifest{}
+	if strings.HasSuffix(path, ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(m)
+	} else {
+		err = yaml.UnmarshalStrict(data, m)
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid manifest %s: %v", path, err)
+		return
+	}
+
+	dir := filepath.Dir(path)
+	names := make(map[string]bool)
+	for i, inst := range m.Instances {
+		if inst.Name == "" {
+			inst.Name = fmt.Sprintf("#%d", i)
+		}
+		if names[inst.Name] {
+			err = fmt.Errorf("duplicate instance name %s", inst.Name)
+			return
+		}
+		names[inst.Name] = true
+
+		for j, input := range inst.Inputs {
+			inst.Inputs[j] = relativeTo(dir, input)
+		}
+		if inst.Output != "" {
+			inst.Output = relativeTo(dir, inst.Output)
+		}
+		if isLocalPkg(inst.Pkg) {
+			inst.Pkg = localPkg(relativeTo(dir, inst.Pkg))
+		}
+	}
+	return
+}
+
+func relativeTo(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// runManifest runs all instances of the manifest at path, or only the one named entry if not empty
+func runManifest(path, entry string) (err error) {
+	m, err := loadManifest(path)
+	if err != nil {
+		return
+	}
+
+	var failed []string
+	found := false
+	for _, inst := range m.Instances {
+		if entry != "" && inst.Name != entry {
+			continue
+		}
+		found = true
+		if err := generate(inst); err != nil {
+			logger.Instance().Error("instance failed", zap.String("name", inst.Name), zap.Error(err))
+			failed = append(failed, inst.Name)
+		}
+	}
+	if entry != "" && !found {
+		return fmt.Errorf("no instance named %s in %s", entry, path)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed instances: %s", strings.Join(failed, ", "))
+	}
+	return
+}
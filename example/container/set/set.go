@@ -4,6 +4,7 @@ package set
 
 type (
 	// Type will be erased after template instantiation
+	//gg:constraint comparable
 	Type  interface{}
 	empty struct{}
 )
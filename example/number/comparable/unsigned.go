@@ -6,8 +6,11 @@ import "unsafe"
 
 type (
 	// SignedType for input
+	//gg:constraint signed
+	//gg:constraint samesize UnsignedType
 	SignedType int64
 	// UnsignedType for output
+	//gg:constraint unsigned
 	UnsignedType uint64
 )
 
@@ -2,6 +2,8 @@ package sort
 
 // DT for data type
 // can be replace by https://github.com/zhiqiangxu/gg
+//
+//gg:constraint ordered
 type DT uint64
 
 // KSmallest for k smallest
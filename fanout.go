@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"strings"
+	"text/template"
+)
+
+var (
+	// ErrFanOut when the types of a fan-out are inconsistent
+	ErrFanOut = errors.New("invalid fan-out")
+)
+
+// patternFuncs are the functions available in patterns of -o, -d, -c, -p and -name
+var patternFuncs = template.FuncMap{
+	"title": upperFirst,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"camel": camel,
+	"word":  typeWord,
+}
+
+// typeWord returns the identifier naming a type expression, e.g. Item for *pkg.Item, int for []int,
+// and the keyword for function, struct and interface types
+func typeWord(s string) string {
+	e, err := parser.ParseExpr(s)
+	if err != nil {
+		return s
+	}
+	for {
+		switch x := e.(type) {
+		case *ast.Ident:
+			return x.Name
+		case *ast.SelectorExpr:
+			return x.Sel.Name
+		case *ast.StarExpr:
+			e = x.X
+		case *ast.ParenExpr:
+			e = x.X
+		case *ast.ArrayType:
+			e = x.Elt
+		case *ast.MapType:
+			e = x.Value
+		case *ast.ChanType:
+			e = x.Value
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.IndexListExpr:
+			e = x.X
+		case *ast.FuncType:
+			return "func"
+		case *ast.StructType:
+			return "struct"
+		case *ast.InterfaceType:
+			return "interface"
+		default:
+			return s
+		}
+	}
+}
+
+// expandPattern executes pattern as a text/template with data, which has the type mappings at least, e.g.
+// `{{.Type|title}}Set` becomes StringSet for Type=string
+func expandPattern(pattern string, data interface{}) (s string, err error) {
+	if !strings.Contains(pattern, "{{") {
+		return pattern, nil
+	}
+	t, err := template.New("pattern").Funcs(patternFuncs).Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		return
+	}
+	s = buf.String()
+	return
+}
+
+// splitTypes splits a comma separated list of types, commas inside brackets, parens and braces are kept
+func splitTypes(s string) (list []string) {
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				list = append(list, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(list, strings.TrimSpace(s[start:]))
+}
+
+// fanOut returns the type mappings of each instance, either from comma separated types
+// of the same length(a single type is shared by all), or one per -for
+func fanOut(inst *instance) (bindings []map[string]string, err error) {
+	lists := make(map[string][]string)
+	n := 1
+	for name, target := range inst.Types {
+		list := splitTypes(target)
+		lists[name] = list
+		if len(list) == 1 {
+			continue
+		}
+		if n > 1 && len(list) != n {
+			err = fmt.Errorf("%v: %s has %d types, others have %d", ErrFanOut, name, len(list), n)
+			return
+		}
+		n = len(list)
+	}
+
+	for i := 0; i < n; i++ {
+		binding := make(map[string]string)
+		for name, list := range lists {
+			if len(list) == 1 {
+				binding[name] = list[0]
+			} else {
+				binding[name] = list[i]
+			}
+		}
+		bindings = append(bindings, binding)
+	}
+	if len(inst.For) == 0 {
+		return
+	}
+	if n > 1 {
+		err = fmt.Errorf("%v: -for can't be used with multiple types in -t", ErrFanOut)
+		return
+	}
+
+	base := bindings[0]
+	bindings = nil
+	for _, f := range inst.For {
+		binding := make(map[string]string)
+		for name, target := range base {
+			binding[name] = target
+		}
+		for _, kv := range strings.Split(f, ";") {
+			if strings.TrimSpace(kv) == "" {
+				continue
+			}
+			sep := strings.Index(kv, "=")
+			if sep == -1 {
+				err = fmt.Errorf("%v: missing '=' from '%s'", ErrFanOut, kv)
+				return
+			}
+			binding[strings.TrimSpace(kv[:sep])] = strings.TrimSpace(kv[sep+1:])
+		}
+		bindings = append(bindings, binding)
+	}
+	return
+}
+
+// expand returns one instance per type mapping of the fan-out of inst,
+// with patterns in output, declares, consts and package name executed
+func expand(inst *instance) (insts []*instance, err error) {
+	bindings, err := fanOut(inst)
+	if err != nil {
+		return
+	}
+
+	outputs := make(map[string]int)
+	for _, binding := range bindings {
+		one := *inst
+		one.Types = binding
+		one.For = nil
+		if one.Output, err = expandPattern(inst.Output, binding); err != nil {
+			return
+		}
+		if one.Package, err = expandPattern(inst.Package, binding); err != nil {
+			return
+		}
+		if one.Declares, err = expandPatterns(inst.Declares, binding); err != nil {
+			return
+		}
+		if one.Consts, err = expandPatterns(inst.Consts, binding); err != nil {
+			return
+		}
+		if one.Methods, err = expandPatterns(inst.Methods, binding); err != nil {
+			return
+		}
+		if one.Fields, err = expandPatterns(inst.Fields, binding); err != nil {
+			return
+		}
+
+		outputs[one.Output]++
+		insts = append(insts, &one)
+	}
+
+	// either all in one output, or one output each
+	if len(outputs) > 1 {
+		for output, n := range outputs {
+			if n > 1 {
+				err = fmt.Errorf("%v: output %s for more than one instance, use a pattern like {{.Type}}_set.go", ErrFanOut, output)
+				return
+			}
+		}
+	}
+	return
+}
+
+func expandPatterns(patterns map[string]string, types map[string]string) (m map[string]string, err error) {
+	m = make(map[string]string, len(patterns))
+	for k, pattern := range patterns {
+		if m[k], err = expandPattern(pattern, types); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+
+	"github.com/zhiqiangxu/gg/pkg/check"
+	"github.com/zhiqiangxu/gg/pkg/diff"
+	"github.com/zhiqiangxu/gg/pkg/generic"
+	"github.com/zhiqiangxu/gg/pkg/globals"
+	"github.com/zhiqiangxu/gg/pkg/merge"
+)
+
+var (
+	// ErrNoInput when no input file is specified
+	ErrNoInput = errors.New("no input file")
+	// ErrTypeCheck when type check of the output failed
+	ErrTypeCheck = errors.New("type check failed")
+	// ErrStale when the output file differs from what would be generated now
+	ErrStale = errors.New("output is stale")
+	// ErrNoOutput when -check or -diff is used without an output file
+	ErrNoOutput = errors.New("no output file to check")
+	// ErrLiteral when a literal in the test files can't be represented by the replacement type
+	ErrLiteral = errors.New("literal not representable")
+	// ErrTypeMethods when methods are declared on replaced types
+	ErrTypeMethods = errors.New("methods on replaced types")
+)
+
+// instance describes one instantiation of a template, either from command line or from a manifest
+type instance struct {
+	// Name identifies the instance in a manifest
+	Name     string            `json:"name" yaml:"name"`
+	Inputs   []string          `json:"inputs" yaml:"inputs"`
+	Types    map[string]string `json:"types" yaml:"types"`
+	Declares map[string]string `json:"declares" yaml:"declares"`
+	Consts   map[string]string `json:"consts" yaml:"consts"`
+	Imports  map[string]string `json:"imports" yaml:"imports"`
+	// Methods and Fields rename members of types, keyed like List.PushFront and Entry.next
+	Methods   map[string]string `json:"methods" yaml:"methods"`
+	Fields    map[string]string `json:"fields" yaml:"fields"`
+	Package   string            `json:"package" yaml:"package"`
+	Prefix    string            `json:"prefix" yaml:"prefix"`
+	Suffix    string            `json:"suffix" yaml:"suffix"`
+	Output    string            `json:"output" yaml:"output"`
+	Derive    bool              `json:"derive" yaml:"derive"`
+	NilCmp    string            `json:"nilcmp" yaml:"nilcmp"`
+	TypeCheck bool              `json:"typecheck" yaml:"typecheck"`
+	// TypeMethods is what to do with methods on replaced types, either error, drop or keep
+	TypeMethods string `json:"typemethods" yaml:"typemethods"`
+	// Keep are the globals to keep with what they refer to, the others are pruned
+	Keep []string `json:"keep" yaml:"keep"`
+	// Prune prunes what is not reachable from the exported globals if Keep is empty
+	Prune bool `json:"prune" yaml:"prune"`
+	// Alias keeps replaced types as aliases of their replacements, references are left alone
+	Alias bool `json:"alias" yaml:"alias"`
+	// Pkg is the template package, either a directory or an import path, instead of Inputs
+	Pkg    string `json:"pkg" yaml:"pkg"`
+	GOOS   string `json:"goos" yaml:"goos"`
+	GOARCH string `json:"goarch" yaml:"goarch"`
+	// Tags are comma separated build tags
+	Tags string `json:"tags" yaml:"tags"`
+	// Tests instantiates the test files of the template into `<output>_test.go`
+	Tests bool `json:"tests" yaml:"tests"`
+	// For lists the type mappings of each instance of a fan-out, e.g. `K=string;V=int`
+	For []string `json:"for" yaml:"for"`
+	// NamePattern renames globals not renamed by Declares, e.g. `{{.Type|title}}{{.Name}}`,
+	// when a fan-out goes to one output, it defaults to the name followed by each replacement
+	// for globals depending on the types
+	NamePattern string `json:"namepattern" yaml:"namepattern"`
+	// KindPatterns are like NamePattern but for globals of the kind, i.e., type, func, var or const
+	KindPatterns map[string]string `json:"kindpatterns" yaml:"kindpatterns"`
+
+	// testInputs are the test files of the template package
+	testInputs []string
+	// silent suppresses the report of pruned declarations, which the test output would repeat
+	silent bool
+	// resolved is true once Pkg is resolved into Inputs
+	resolved bool
+}
+
+// outputFile is a file to be written by generate
+type outputFile struct {
+	Path    string
+	Content []byte
+}
+
+// generate instantiates the template for each type of the fan-out and writes the outputs
+func generate(inst *instance) (err error) {
+	files, err := renderAll(inst)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		if err = writeFile(file.Path, file.Content); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// renderAll instantiates the template for each type of the fan-out and returns the outputs,
+// a fan-out into one output is combined
+func renderAll(inst *instance) (files []outputFile, err error) {
+	if err = resolveInputs(inst); err != nil {
+		return
+	}
+	insts, err := expand(inst)
+	if err != nil {
+		return
+	}
+	if sameOutput(insts) {
+		return renderCombined(inst, insts)
+	}
+
+	for _, one := range insts {
+		var oneFiles []outputFile
+		oneFiles, err = render(one)
+		if err != nil {
+			return
+		}
+		files = append(files, oneFiles...)
+	}
+	return
+}
+
+// render instantiates the template and returns the outputs prefixed with the generation header,
+// the instantiated test files follow the output with -tests
+func render(inst *instance) (files []outputFile, err error) {
+	if err = resolveInputs(inst); err != nil {
+		return
+	}
+
+	h, err := header(inst)
+	if err != nil {
+		return
+	}
+
+	df, _, err := instantiate(inst, inst.Inputs)
+	if err != nil {
+		return
+	}
+	content, err := formatFile(h, df)
+	if err != nil {
+		return
+	}
+	files = append(files, outputFile{Path: inst.Output, Content: content})
+
+	if inst.Tests {
+		if content, err = renderTests(inst, h); err != nil {
+			return
+		}
+		files = append(files, outputFile{Path: testOutput(inst.Output), Content: content})
+	}
+	return
+}
+
+// renderTests instantiates the template along with its test files, and keeps only what comes from the test files
+func renderTests(inst *instance, h string) (content []byte, err error) {
+	if len(inst.testInputs) == 0 {
+		err = ErrNoTests
+		return
+	}
+
+	// the test files refer to declarations of the template, so they're instantiated together
+	testInst := *inst
+	// -typecheck only applies to the output, the test output depends on it being written
+	testInst.TypeCheck = false
+	testInst.silent = true
+	df, templatePos, err := instantiate(&testInst, templateInputs(inst))
+	if err != nil {
+		return
+	}
+
+	tests := make(map[string]bool)
+	for _, input := range inst.testInputs {
+		tests[input] = true
+	}
+	var decls []dst.Decl
+	for _, d := range df.Decls {
+		if gd, ok := d.(*dst.GenDecl); ok && gd.Tok == token.IMPORT || tests[templatePos(d).Filename] {
+			decls = append(decls, d)
+		}
+	}
+	df.Decls = decls
+	globals.OrganizeImports(df)
+	// the package doc, with its run: lines, belongs to the output
+	df.Decs.Start = buildConstraints(df.Decs.Start)
+
+	return formatFile(h, df)
+}
+
+// buildConstraints returns the build constraint lines of decorations
+func buildConstraints(decs dst.Decorations) (constraints dst.Decorations) {
+	for _, d := range decs {
+		if strings.HasPrefix(d, "//go:build") || strings.HasPrefix(d, "// +build") {
+			constraints = append(constraints, d)
+		}
+	}
+	return
+}
+
+// formatFile formats df prefixed with the generation header
+func formatFile(h string, df *dst.File) (content []byte, err error) {
+	// dst -> ast
+	fset, f, err := decorator.RestoreFile(df)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(h)
+	if err = format.Node(&buf, fset, f); err != nil {
+		return
+	}
+	content = buf.Bytes()
+	return
+}
+
+// parsedTemplate is the template files parsed into one dst.File, which is cloned for each instance
+type parsedTemplate struct {
+	fset  *token.FileSet
+	df    *dst.File
+	nodes map[dst.Node]ast.Node // dst node -> template node, for positions
+}
+
+// parsedTemplates caches parsed templates by their files, so that a template is parsed only once
+var parsedTemplates = make(map[string]*parsedTemplate)
+
+// parseTemplate parses the template files inputs, multiple files are merged into one
+func parseTemplate(inputs []string) (pt *parsedTemplate, err error) {
+	key := strings.Join(inputs, "\x00")
+	if pt = parsedTemplates[key]; pt != nil {
+		return
+	}
+
+	pt = &parsedTemplate{fset: token.NewFileSet()}
+	if len(inputs) > 1 {
+		pt.df, pt.nodes, err = merge.PackageFilesDst(pt.fset, inputs)
+		if err != nil {
+			return
+		}
+	} else {
+		// Parse the input file.
+		var f *ast.File
+		f, err = parser.ParseFile(pt.fset, inputs[0], nil, parser.ParseComments|parser.DeclarationErrors|parser.SpuriousErrors)
+		if err != nil {
+			return
+		}
+
+		// ast -> dst for comment
+		dec := decorator.NewDecorator(pt.fset)
+		pt.df, err = dec.DecorateFile(f)
+		if err != nil {
+			return
+		}
+		pt.nodes = dec.Ast.Nodes
+	}
+
+	parsedTemplates[key] = pt
+	return
+}
+
+// clone returns a copy of the template to be rewritten, along with the template position of its nodes
+func (pt *parsedTemplate) clone() (df *dst.File, templatePos func(dst.Node) token.Position) {
+	df = dst.Clone(pt.df).(*dst.File)
+
+	// the copy has the same shape, so nodes correspond in order
+	var origs []dst.Node
+	dst.Inspect(pt.df, func(n dst.Node) bool {
+		if n != nil {
+			origs = append(origs, n)
+		}
+		return true
+	})
+	origOf := make(map[dst.Node]dst.Node, len(origs))
+	i := 0
+	dst.Inspect(df, func(n dst.Node) bool {
+		if n != nil {
+			origOf[n] = origs[i]
+			i++
+		}
+		return true
+	})
+
+	templatePos = func(n dst.Node) token.Position {
+		if orig, ok := origOf[n]; ok {
+			return pt.pos(orig)
+		}
+		return token.Position{}
+	}
+	return
+}
+
+// pos returns the template position of n
+func (pt *parsedTemplate) pos(n dst.Node) token.Position {
+	if an, ok := pt.nodes[n]; ok {
+		return pt.fset.Position(an.Pos())
+	}
+	return token.Position{}
+}
+
+// instantiate runs the whole pipeline on the template files inputs with the settings of inst
+func instantiate(inst *instance, inputs []string) (df *dst.File, templatePos func(dst.Node) token.Position, err error) {
+	if len(inputs) == 0 {
+		err = ErrNoInput
+		return
+	}
+
+	pt, err := parseTemplate(inputs)
+	if err != nil {
+		return
+	}
+	df, templatePos = pt.clone()
+
+	// qualifiers of replacement types are imported if -import doesn't
+	if inst, err = inferImports(inst, globals.GetImportMapDst(df)); err != nil {
+		return
+	}
+
+	// check params
+	if err = checkParams(inst, globals.GetImportMapDst(df)); err != nil {
+		return
+	}
+
+	// unreachable declarations are pruned before anything is checked against them
+	if err = prune(inst, df, templatePos); err != nil {
+		return
+	}
+
+	// generic code is made concrete first, the other types are placeholders
+	if generic.IsGeneric(df) {
+		if err = generic.Monomorphize(df, typeArgs(inst, df)); err != nil {
+			return
+		}
+	}
+
+	// check replacements against constraints of placeholder types
+	if err = check.Constraints(df, inst.Types, inst.Imports); err != nil {
+		return
+	}
+
+	// test data must be representable by the replacement types
+	if err = checkLiterals(inst, df, templatePos); err != nil {
+		return
+	}
+
+	// nil is not a valid value for some replacement types
+	if err = replaceNil(inst, df, templatePos); err != nil {
+		return
+	}
+
+	// replaced types are removed at last, found before they are renamed
+	placeholders, err := placeholderDecls(inst, df, templatePos)
+	if err != nil {
+		return
+	}
+
+	// types are treated similar to declares, except that the old type will be removed at lasat
+	declares := make(map[string]string)
+	for k, v := range inst.Declares {
+		declares[k] = v
+	}
+	methods := make(map[string]string)
+	if inst.Derive {
+		var derived, derivedMethods map[string]string
+		derived, derivedMethods, err = globals.DeriveNames(df, inst.Types, declares)
+		if err != nil {
+			return
+		}
+		for k, v := range derived {
+			declares[k] = v
+		}
+		for k, v := range derivedMethods {
+			methods[k] = v
+		}
+	}
+	for k, v := range inst.Methods {
+		methods[k] = v
+	}
+	if !inst.Alias {
+		for k, v := range inst.Types {
+			declares[k] = v
+		}
+	}
+
+	// members are resolved by the types, so before the types are renamed
+	if err = globals.RenameMembers(df, methods, inst.Fields); err != nil {
+		return
+	}
+	// the implicit names of embedded fields change along with the types
+	embeds, err := globals.EmbeddedFields(df)
+	if err != nil {
+		return
+	}
+
+	if inst.Package != "" {
+		globals.RenamePkg(df, inst.Package)
+	}
+	globals.UpdateConstValue(df, inst.Consts)
+	// used for changing comment
+	new2old := map[string]string{}
+	globals.RenameDecl(df, func(ident *dst.Ident, kind globals.SymKind) {
+		old := ident.Name
+		if declares[ident.Name] != "" {
+			ident.Name = declares[ident.Name]
+		}
+		// replaced types, imports and names with a meaning of their own are not named after the patterns
+		if _, ok := inst.Types[old]; !ok && kind != globals.KindImport && !reservedName(old, kind, df.Name.Name) {
+			if _, ok := inst.Declares[old]; !ok {
+				var nameErr error
+				if ident.Name, nameErr = inst.globalName(ident.Name, kind, inst.Types); nameErr != nil && err == nil {
+					err = nameErr
+				}
+			}
+			ident.Name = inst.Prefix + ident.Name + inst.Suffix
+		}
+		new2old[ident.Name] = old
+	})
+	if err != nil {
+		return
+	}
+	for _, e := range embeds {
+		e.Update()
+	}
+	// replacement types like *T may not fit where the placeholder did
+	globals.ParenthesizeTypes(df)
+
+	// remove replaced types, or make them aliases
+	if inst.Alias {
+		for n := range placeholders {
+			if ts, ok := n.(*dst.TypeSpec); ok {
+				ts.TypeParams = nil
+				ts.Assign = true
+				ts.Type = dst.NewIdent(inst.Types[ts.Name.Name])
+				delete(placeholders, n)
+			}
+		}
+	}
+	globals.RemoveNodes(df, placeholders)
+
+	{
+
+		if *debug {
+			fmt.Println("new2old", new2old, "types", inst.Types)
+		}
+
+		// update comments
+		{
+			globals.UpdateComment(df, func(newName string, node dst.Node) {
+				oldName := new2old[newName]
+				if newName == oldName {
+					return
+				}
+
+				for i, comment := range node.Decorations().Start {
+					node.Decorations().Start[i] = strings.ReplaceAll(comment, oldName, newName)
+				}
+			})
+		}
+
+		// add imports, and leave one sorted block of those used
+		if len(inst.Imports) > 0 {
+			globals.AddImports(df, inst.Imports)
+		}
+		globals.OrganizeImports(df)
+
+		// type check the output
+		if inst.TypeCheck {
+			err = typeCheck(inst, df, templatePos)
+		}
+	}
+
+	return
+}
+
+// typeArgs returns the types of -t for type parameters of generic declarations in df,
+// e.g. List.T=int, or T=int for all declarations with type parameter T
+func typeArgs(inst *instance, df *dst.File) map[string]string {
+	params := generic.TypeParams(df)
+	args := make(map[string]string)
+	for name, target := range inst.Types {
+		if params[name] {
+			args[name] = target
+		}
+	}
+	return args
+}
+
+// writeFile writes the output to path, or stdout if path is empty.
+// With -check or -diff, path is compared with the output instead.
+func writeFile(path string, content []byte) (err error) {
+	if *checkStale || *showDiff {
+		return compareFile(path, content)
+	}
+	if path == "" {
+		fmt.Println(string(content))
+		return
+	}
+	err = ioutil.WriteFile(path, content, 0644)
+	return
+}
+
+// compareFile compares the content of path with output, prints the unified diff for -diff,
+// and reports ErrStale for -check if they differ
+func compareFile(path string, output []byte) (err error) {
+	if path == "" {
+		return ErrNoOutput
+	}
+
+	old, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+
+	d := diff.Unified(path, path+" (generated)", old, output)
+	if d == "" {
+		return
+	}
+	if *showDiff {
+		fmt.Print(d)
+	}
+	if *checkStale {
+		err = fmt.Errorf("%v: %s", ErrStale, path)
+	}
+	return
+}
+
+// typeCheck type checks the output and reports errors against both the template and the output
+func typeCheck(inst *instance, df *dst.File, templatePos func(dst.Node) token.Position) (err error) {
+	errs, err := check.File(df, inst.Output, templatePos)
+	if err != nil {
+		return
+	}
+	if len(errs) == 0 {
+		return
+	}
+
+	// the output is written after the generation header
+	h, err := header(inst)
+	if err != nil {
+		return
+	}
+	for _, e := range errs {
+		e.Generated.Line += strings.Count(h, "\n")
+		fmt.Fprintln(os.Stderr, e)
+	}
+	return fmt.Errorf("%v: %d errors", ErrTypeCheck, len(errs))
+}
+
+// placeholderDecls returns the declarations of replaced types to remove, methods on them are
+// reported, removed, or kept for local replacement types according to inst.TypeMethods
+func placeholderDecls(inst *instance, df *dst.File, templatePos func(dst.Node) token.Position) (nodes map[dst.Node]bool, err error) {
+	var placeholders []string
+	for name := range inst.Types {
+		placeholders = append(placeholders, name)
+	}
+	sort.Strings(placeholders)
+
+	nodes = make(map[dst.Node]bool)
+	for _, ts := range globals.TypeSpecs(df, placeholders) {
+		nodes[ts] = true
+	}
+	methods := globals.MethodsOf(df, placeholders)
+	if len(methods) == 0 {
+		return
+	}
+
+	switch inst.TypeMethods {
+	case "", "error":
+		var names []string
+		for _, fd := range methods {
+			names = append(names, globals.RecvTypeName(fd)+"."+fd.Name.Name)
+		}
+		err = fmt.Errorf("%v: %s, use -typemethods drop or keep", ErrTypeMethods, strings.Join(names, ", "))
+	case "drop":
+		// calls of the dropped methods wouldn't compile
+		var uses []*dst.Ident
+		if uses, err = globals.MethodUses(df, methods); err != nil {
+			return
+		}
+		if len(uses) > 0 {
+			var used []string
+			for _, id := range uses {
+				used = append(used, fmt.Sprintf("%s: %s", templatePos(id), id.Name))
+			}
+			err = fmt.Errorf("%v: can't drop methods still used: %s", ErrTypeMethods, strings.Join(used, ", "))
+			return
+		}
+		for _, fd := range methods {
+			nodes[fd] = true
+		}
+	case "keep":
+		var nonLocal []string
+		for _, fd := range methods {
+			recv := globals.RecvTypeName(fd)
+			if !isLocalType(inst.Types[recv]) {
+				nonLocal = append(nonLocal, fmt.Sprintf("%s.%s(%s=%s)", recv, fd.Name.Name, recv, inst.Types[recv]))
+			}
+		}
+		if len(nonLocal) > 0 {
+			err = fmt.Errorf("%v: can only be kept for types of the output package: %s", ErrTypeMethods, strings.Join(nonLocal, ", "))
+		}
+	default:
+		err = fmt.Errorf("unknown -typemethods %s, want error, drop or keep", inst.TypeMethods)
+	}
+	return
+}
+
+// isLocalType reports whether t names a type which can be declared in the output package
+func isLocalType(t string) bool {
+	return token.IsIdentifier(t) && types.Universe.Lookup(t) == nil
+}
+
+// replaceNil rewrites nil used as a value of replaced types to the zero value
+// when the new type can not be nil
+func replaceNil(inst *instance, df *dst.File, templatePos func(dst.Node) token.Position) (err error) {
+	var typeNames []string
+	for name, target := range inst.Types {
+		if !globals.Nilable(df, target, inst.Imports) {
+			typeNames = append(typeNames, name)
+		}
+	}
+	if len(typeNames) == 0 {
+		return
+	}
+
+	var (
+		m       = make(map[*dst.Ident]dst.Expr)
+		badCmps []string
+	)
+	for _, use := range globals.FindNil(df, typeNames) {
+		if use.Cmp != nil && inst.NilCmp != "zero" {
+			badCmps = append(badCmps, fmt.Sprintf("%s: %s compared with nil", templatePos(use.Nil), use.TypeName))
+			continue
+		}
+		m[use.Nil] = globals.ZeroValue(use.TypeName, inst.Types[use.TypeName])
+	}
+	if len(badCmps) > 0 {
+		return fmt.Errorf("nil comparison for non-nilable type, use -nilcmp zero to compare with zero value instead: %s", strings.Join(badCmps, "; "))
+	}
+
+	globals.ReplaceNil(df, m)
+	return
+}
+
+// checkLiterals reports literals in the test files used as values of replaced types,
+// which the new types can not represent
+func checkLiterals(inst *instance, df *dst.File, templatePos func(dst.Node) token.Position) (err error) {
+	if !inst.Tests {
+		return
+	}
+
+	lits, err := check.Literals(df, inst.Types, inst.Imports)
+	if err != nil {
+		return
+	}
+
+	tests := make(map[string]bool)
+	for _, input := range inst.testInputs {
+		tests[input] = true
+	}
+	var bad []string
+	for _, lit := range lits {
+		pos := templatePos(lit.Lit)
+		if !tests[pos.Filename] {
+			continue
+		}
+		bad = append(bad, fmt.Sprintf("%s: %s can not represent %s used as %s", pos, lit.Target, lit.Value, lit.TypeName))
+	}
+	if len(bad) > 0 {
+		err = fmt.Errorf("%v: %s", ErrLiteral, strings.Join(bad, "; "))
+	}
+	return
+}
+
+func checkParams(inst *instance, importMap map[string]string) (err error) {
+	for _, exprStr := range inst.Types {
+		var expr ast.Expr
+		expr, err = parser.ParseExpr(exprStr)
+		if err != nil {
+			return
+		}
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.SelectorExpr:
+				id := globals.GetIdent(x.X)
+				if id == nil {
+					err = fmt.Errorf("invalid SelectorExpr in %s", exprStr)
+					return false
+				}
+				importName := id.Name
+				if importMap[importName] == "" && inst.Imports[importName] == "" {
+					err = fmt.Errorf("invalid importName %s in %s", importName, exprStr)
+					return false
+				}
+				if !ast.IsExported(x.Sel.Name) {
+					err = fmt.Errorf("unexported %s.%s in %s", importName, x.Sel.Name, exprStr)
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -1,11 +1,25 @@
 module github.com/zhiqiangxu/gg
 
-go 1.12
+go 1.18
 
 require (
-	github.com/dave/dst v0.23.1
+	github.com/dave/dst v0.27.3
 	github.com/zhiqiangxu/util v0.0.0-20200215063011-61cbfcd48f7d
 	go.uber.org/zap v1.13.0
-	golang.org/x/tools v0.0.0-20191029190741-b9c20aec41a5
+	golang.org/x/tools v0.1.12
+	gopkg.in/yaml.v2 v2.2.8
 	gotest.tools v2.2.0+incompatible
 )
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/google/go-cmp v0.3.1 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	go.uber.org/atomic v1.5.0 // indirect
+	go.uber.org/multierr v1.3.0 // indirect
+	go.uber.org/tools v0.0.0-20190618225709-2cfd321de3ee // indirect
+	golang.org/x/lint v0.0.0-20190930215403-16217165b5de // indirect
+	golang.org/x/mod v0.6.0-dev.0.20220419223038-86c51ed26bb4 // indirect
+	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
+	honnef.co/go/tools v0.0.1-2019.2.3 // indirect
+)
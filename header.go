@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// generatedLine marks gg output as generated, see https://golang.org/s/generatedcode
+	generatedLine = "// Code generated by gg. DO NOT EDIT."
+	// argsDirective records the normalized arguments, inputs are relative to the output
+	argsDirective = "//gg:args "
+	// hashDirective records the hash of the template contents
+	hashDirective = "//gg:hash "
+	// hashPrefix is the algorithm of the hash
+	hashPrefix = "sha256:"
+)
+
+var (
+	// ErrNoHeader when a file has no generation header
+	ErrNoHeader = errors.New("no gg generation header")
+)
+
+// generationHeader is what's recorded in the header of gg output
+type generationHeader struct {
+	Args []string
+	Hash string
+}
+
+// header returns the generation header for inst
+func header(inst *instance) (h string, err error) {
+	args, err := instanceArgs(inst)
+	if err != nil {
+		return
+	}
+	hash, err := templateHash(templateInputs(inst))
+	if err != nil {
+		return
+	}
+
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, quoteArg(arg))
+	}
+	h = fmt.Sprintf("%s\n%s%s\n%s%s\n\n", generatedLine, argsDirective, strings.Join(quoted, " "), hashDirective, hash)
+	return
+}
+
+// instanceArgs returns the normalized arguments to reproduce inst, inputs are relative to the output
+func instanceArgs(inst *instance) (args []string, err error) {
+	outDir := "."
+	if inst.Output != "" {
+		outDir = filepath.Dir(inst.Output)
+	}
+	if inst.Pkg != "" {
+		pkg := inst.Pkg
+		if isLocalPkg(pkg) {
+			if pkg, err = relPath(outDir, pkg); err != nil {
+				return
+			}
+			pkg = localPkg(pkg)
+		}
+		args = append(args, "-pkg", pkg)
+		if inst.GOOS != "" {
+			args = append(args, "-goos", inst.GOOS)
+		}
+		if inst.GOARCH != "" {
+			args = append(args, "-goarch", inst.GOARCH)
+		}
+		if inst.Tags != "" {
+			args = append(args, "-tags", inst.Tags)
+		}
+	} else {
+		for _, input := range inst.Inputs {
+			var rel string
+			rel, err = relPath(outDir, input)
+			if err != nil {
+				return
+			}
+			args = append(args, "-i", rel)
+		}
+	}
+
+	mapArgs := func(flag string, m map[string]string) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = append(args, flag, k+"="+m[k])
+		}
+	}
+	mapArgs("-t", inst.Types)
+	mapArgs("-d", inst.Declares)
+	mapArgs("-c", inst.Consts)
+	mapArgs("-m", inst.Methods)
+	mapArgs("-f", inst.Fields)
+	mapArgs("-import", inst.Imports)
+
+	if inst.Package != "" {
+		args = append(args, "-p", inst.Package)
+	}
+	if inst.Prefix != "" {
+		args = append(args, "-prefix", inst.Prefix)
+	}
+	if inst.Suffix != "" {
+		args = append(args, "-suffix", inst.Suffix)
+	}
+	if inst.Derive {
+		args = append(args, "-derive")
+	}
+	if inst.NilCmp != "" && inst.NilCmp != "error" {
+		args = append(args, "-nilcmp", inst.NilCmp)
+	}
+	if inst.TypeMethods != "" && inst.TypeMethods != "error" {
+		args = append(args, "-typemethods", inst.TypeMethods)
+	}
+	if len(inst.Keep) > 0 {
+		args = append(args, "-keep", strings.Join(inst.Keep, ","))
+	}
+	if inst.Prune {
+		args = append(args, "-prune")
+	}
+	if inst.Alias {
+		args = append(args, "-alias")
+	}
+	if inst.Tests {
+		args = append(args, "-tests")
+	}
+	for _, f := range inst.For {
+		args = append(args, "-for", f)
+	}
+	if inst.NamePattern != "" {
+		args = append(args, "-name", inst.NamePattern)
+	}
+	for _, kind := range sortedKeys(inst.KindPatterns) {
+		args = append(args, "-name", kind+":"+inst.KindPatterns[kind])
+	}
+	return
+}
+
+// relPath returns path relative to dir in slash form
+func relPath(dir, path string) (rel string, err error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	rel, err = filepath.Rel(absDir, absPath)
+	rel = filepath.ToSlash(rel)
+	return
+}
+
+// templateHash hashes the contents of the template files in order
+func templateHash(inputs []string) (hash string, err error) {
+	h := sha256.New()
+	for _, input := range inputs {
+		var data []byte
+		data, err = ioutil.ReadFile(input)
+		if err != nil {
+			return
+		}
+		h.Write(data)
+	}
+	hash = hashPrefix + hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// quoteArg quotes arg for splitArgs if needed
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"") {
+		return arg
+	}
+	if !strings.Contains(arg, "'") {
+		return "'" + arg + "'"
+	}
+	return `"` + arg + `"`
+}
+
+// readHeader reads the generation header of a gg generated file
+func readHeader(path string) (h *generationHeader, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	generated := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == generatedLine:
+			generated = true
+			h = &generationHeader{}
+		case !generated:
+			if !strings.HasPrefix(line, "//") && strings.TrimSpace(line) != "" {
+				// the header must precede the code
+				err = ErrNoHeader
+				return
+			}
+		case strings.HasPrefix(line, argsDirective):
+			h.Args = splitArgs(strings.TrimPrefix(line, argsDirective))
+		case strings.HasPrefix(line, hashDirective):
+			h.Hash = strings.TrimPrefix(line, hashDirective)
+			return
+		default:
+			err = fmt.Errorf("%v: malformed header in %s", ErrNoHeader, path)
+			return
+		}
+	}
+	if err = scanner.Err(); err == nil {
+		err = ErrNoHeader
+	}
+	return
+}
+
+// headerInstance builds the instance recorded in the header of path
+func headerInstance(path string, h *generationHeader) (inst *instance, err error) {
+	fs := flag.NewFlagSet("header", flag.ContinueOnError)
+	newInstance := instanceFlags(fs)
+	if err = fs.Parse(h.Args); err != nil {
+		return
+	}
+
+	inst = newInstance()
+	dir := filepath.Dir(path)
+	for i, input := range inst.Inputs {
+		inst.Inputs[i] = relativeTo(dir, filepath.FromSlash(input))
+	}
+	if isLocalPkg(inst.Pkg) {
+		inst.Pkg = localPkg(relativeTo(dir, filepath.FromSlash(inst.Pkg)))
+	}
+	inst.Output = path
+	if inst.Tests && strings.HasSuffix(path, "_test.go") {
+		// the test output is generated along with the output
+		inst.Output = strings.TrimSuffix(path, "_test.go") + ".go"
+	}
+	return
+}
+
+// regenCommand implements `gg regen [-check] [-diff] file...`, which generates
+// the files again using only what their headers record
+func regenCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("regen", flag.ExitOnError)
+	fs.BoolVar(checkStale, "check", false, "don't write the files, exit non-zero if any file differs from what would be generated")
+	fs.BoolVar(showDiff, "diff", false, "don't write the files, print the unified diff instead")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s regen [options] file...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var failed []string
+	for _, path := range fs.Args() {
+		if err := regen(path); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	if len(failed) > 0 {
+		err = fmt.Errorf("regen failed: %s", strings.Join(failed, "; "))
+	}
+	return
+}
+
+func regen(path string) (err error) {
+	h, err := readHeader(path)
+	if err != nil {
+		return
+	}
+	inst, err := headerInstance(path, h)
+	if err != nil {
+		return
+	}
+	return generate(inst)
+}
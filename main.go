@@ -4,34 +4,20 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
-	"go/ast"
-	"go/format"
-	"go/parser"
-	"go/token"
-	"io/ioutil"
 	"os"
 	"strings"
 
-	"github.com/dave/dst"
-	"github.com/dave/dst/decorator"
 	"go.uber.org/zap"
 
-	"github.com/zhiqiangxu/gg/pkg/globals"
-	"github.com/zhiqiangxu/gg/pkg/merge"
 	"github.com/zhiqiangxu/util/logger"
 )
 
 var (
-	output      = flag.String("o", "", "output `file`")
-	debug       = flag.Bool("debug", false, "`debug` mode")
-	suffix      = flag.String("suffix", "", "`suffix` to add to each global symbol")
-	prefix      = flag.String("prefix", "", "`prefix` to add to each global symbol")
-	packageName = flag.String("p", "", "output package `name`")
-	inFiles     []string
-	types       = make(map[string]string)
-	declares    = make(map[string]string)
-	consts      = make(map[string]string)
-	imports     = make(map[string]string)
+	debug      = flag.Bool("debug", false, "`debug` mode")
+	checkStale = flag.Bool("check", false, "don't write the output, exit non-zero if the output file differs from what would be generated")
+	showDiff   = flag.Bool("diff", false, "don't write the output, print the unified diff between the output file and what would be generated")
+	config     = flag.String("config", "", "run all instantiations listed in the manifest `file`(yaml, or json if ends with .json)")
+	entry      = flag.String("entry", "", "only run the instantiation with `name` in the manifest")
 )
 
 type sliceValue []string
@@ -89,169 +75,127 @@ func (m mapValue) Set(s string) error {
 }
 
 func main() {
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
-		flag.PrintDefaults()
-	}
-
-	flag.Var((*sliceValue)(&inFiles), "i", "specify the input file. Multiple files are allowed by multiple -i.")
-	flag.Var(mapValue(declares), "d", "rename global A(can be either of Type/Var/Func/Const) to B when `A=B` is passed in. Multiple such mappings are allowed.")
-	flag.Var(mapValue(consts), "c", "reassign constant A to value B when `A=B` is passed in. Multiple such mappings are allowed.")
-	flag.Var(mapValue(types), "t", "replace type A to type B when `A=B` is passed in. Multiple such mappings are allowed.")
-	flag.Var(mapValue(imports), "import", "add new imports. `name=path` specifies that 'name', used in types as name.type, refers to the package living in 'path'.")
-	flag.Parse()
-
-	// inFiles = []string{"example/container/ilist/ilist.go"}
-	// *output = "test2.go"
-	// declares = map[string]string{"GlobalType": "GlobalType2"}
-	// types = map[string]string{"Linker": "xxxxxxxxxxxxxxxx"}
-
-	if len(inFiles) == 0 {
-		flag.Usage()
-		os.Exit(1)
-	}
-
-	var (
-		mergedCode string
-		err        error
-	)
-	if len(inFiles) > 1 {
-		mergedCode, err = merge.PackageFiles(inFiles)
-		if err != nil {
-			logger.Instance().Fatal("PackageFiles", zap.Error(err))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			if err := runCommand(os.Args[2:]); err != nil {
+				logger.Instance().Fatal("run", zap.Error(err))
+			}
+			return
+		case "regen":
+			if err := regenCommand(os.Args[2:]); err != nil {
+				logger.Instance().Fatal("regen", zap.Error(err))
+			}
+			return
+		case "verify":
+			if err := verifyCommand(os.Args[2:]); err != nil {
+				logger.Instance().Fatal("verify", zap.Error(err))
+			}
+			return
+		case "togeneric":
+			if err := togenericCommand(os.Args[2:]); err != nil {
+				logger.Instance().Fatal("togeneric", zap.Error(err))
+			}
+			return
 		}
 	}
 
-	// Parse the input file.
-	fset := token.NewFileSet()
-	var f *ast.File
-	if mergedCode != "" {
-		f, err = parser.ParseFile(fset, "", mergedCode, parser.ParseComments|parser.DeclarationErrors|parser.SpuriousErrors)
-	} else {
-		f, err = parser.ParseFile(fset, inFiles[0], nil, parser.ParseComments|parser.DeclarationErrors|parser.SpuriousErrors)
-	}
-	if err != nil {
-		logger.Instance().Fatal("ParseFile", zap.Error(err))
-	}
-
-	// check params
-	checkParams(f)
-
-	// ast -> dst for comment
-	df, err := decorator.DecorateFile(fset, f)
-	if err != nil {
-		logger.Instance().Fatal("ecorator.DecorateFile", zap.Error(err))
-	}
-
-	// types are treated similar to declares, except that the old type will be removed at lasat
-	if declares == nil {
-		declares = make(map[string]string)
-	}
-	for k, v := range types {
-		declares[k] = v
-	}
-
-	if *packageName != "" {
-		globals.RenamePkg(df, *packageName)
-	}
-	globals.UpdateConstValue(df, consts)
-	// used for changing comment
-	new2old := map[string]string{}
-	globals.RenameDecl(df, func(ident *dst.Ident, kind globals.SymKind) {
-		old := ident.Name
-		if declares[ident.Name] != "" {
-			ident.Name = declares[ident.Name]
-		}
-		ident.Name = *prefix + ident.Name + *prefix
-		new2old[ident.Name] = old
-	})
-
-	// remove replaced types
-	{
-		var types2Remove []string
-		for _, name := range types {
-			types2Remove = append(types2Remove, name)
-		}
-		globals.RemoveDecl(df, types2Remove)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n       %s run [options] [dir|dir/...]...\n       %s regen [options] file...\n       %s verify [options] [dir|dir/...]...\n       %s togeneric [options]\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
 	}
 
-	{
-
-		if *debug {
-			fmt.Println("new2old", new2old, "types", types)
-		}
-
-		// update comments
-		{
-			globals.UpdateComment(df, func(newName string, node dst.Node) {
-				oldName := new2old[newName]
-				if newName == oldName {
-					return
-				}
-
-				for i, comment := range node.Decorations().Start {
-					node.Decorations().Start[i] = strings.ReplaceAll(comment, oldName, newName)
-				}
-			})
-		}
-
-		// add imports
-		if len(imports) > 0 {
-			globals.AddImports(df, imports)
-		}
+	newInstance := instanceFlags(flag.CommandLine)
+	flag.Parse()
 
-		// dst -> ast
-		fset, f, err = decorator.RestoreFile(df)
-		if err != nil {
-			logger.Instance().Fatal("ecorator.RestoreFile", zap.Error(err))
+	if *config != "" {
+		if err := runManifest(*config, *entry); err != nil {
+			logger.Instance().Fatal("runManifest", zap.String("config", *config), zap.Error(err))
 		}
+		return
 	}
 
-	err = writeFile(*output, fset, f)
-	if err != nil {
-		logger.Instance().Fatal("writeFile", zap.Error(err))
+	inst := newInstance()
+	if len(inst.Inputs) == 0 && inst.Pkg == "" {
+		flag.Usage()
+		os.Exit(1)
 	}
-}
 
-func writeFile(path string, fset *token.FileSet, node interface{}) (err error) {
-	var buf bytes.Buffer
-	if err = format.Node(&buf, fset, node); err != nil {
-		logger.Instance().Error("format.Node", zap.Error(err))
-		return
-	}
-	if path == "" {
-		fmt.Println(buf.String())
-		return
+	if err := generate(inst); err != nil {
+		logger.Instance().Fatal("generate", zap.Error(err))
 	}
-	if err = ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
-		logger.Instance().Error("WriteFile", zap.Error(err))
-		return
-	}
-	return
 }
 
-func checkParams(f *ast.File) {
-	importMap := globals.GetImportMap(f)
+// instanceFlags registers the flags describing an instance on fs,
+// the returned function builds the instance once fs is parsed.
+func instanceFlags(fs *flag.FlagSet) func() *instance {
+	var (
+		output          = fs.String("o", "", "output `file`, can be a pattern like {{.Type}}_set.go for a fan-out")
+		suffix          = fs.String("suffix", "", "`suffix` to add to each global symbol")
+		prefix          = fs.String("prefix", "", "`prefix` to add to each global symbol")
+		packageName     = fs.String("p", "", "output package `name`")
+		typeMethods     = fs.String("typemethods", "error", "what to do with methods declared on replaced types, either error, drop, or keep when the replacement is a type of the output package")
+		keep            = fs.String("keep", "", "comma separated `globals` of the template to keep along with what they refer to, the others are pruned")
+		alias           = fs.Bool("alias", false, "keep replaced types as aliases like `type A = B` and leave their references alone")
+		pruneOutput     = fs.Bool("prune", false, "prune declarations not reachable from the exported globals, or from -keep, along with the imports no longer used")
+		nilCmp          = fs.String("nilcmp", "error", "what to do with `x == nil` when x's type is replaced by a type which can not be nil, either error or zero(compare with zero value)")
+		typeCheckOutput = fs.Bool("typecheck", false, "type check the output, errors are reported against the template and the output")
+		derive          = fs.Bool("derive", false, "derive new names for globals and methods containing a replaced type name, e.g. SomethingQueue => StringQueue for -t Something=string")
+		pkg             = fs.String("pkg", "", "template package, either a `dir` or an import path, all its non-test go files matching the build constraints are used instead of -i")
+		goos            = fs.String("goos", "", "GOOS for build constraints of -pkg, defaults to the current one")
+		goarch          = fs.String("goarch", "", "GOARCH for build constraints of -pkg, defaults to the current one")
+		tags            = fs.String("tags", "", "comma separated build `tags` for build constraints of -pkg")
+		tests           = fs.Bool("tests", false, "also instantiate the test files of the template into <output>_test.go")
+		namePattern     string
+		kindPatterns    = make(map[string]string)
+		inFiles         []string
+		fors            []string
+		types           = make(map[string]string)
+		declares        = make(map[string]string)
+		consts          = make(map[string]string)
+		imports         = make(map[string]string)
+		methods         = make(map[string]string)
+		fields          = make(map[string]string)
+	)
 
-	for _, exprStr := range types {
-		expr, err := parser.ParseExpr(exprStr)
-		if err != nil {
-			logger.Instance().Fatal("parser.ParseExpr", zap.Error(err))
+	fs.Var((*sliceValue)(&inFiles), "i", "specify the input file. Multiple files are allowed by multiple -i.")
+	fs.Var(namePatternsValue{all: &namePattern, kinds: kindPatterns}, "name", "`[kind:]pattern` to rename globals not renamed by -d, e.g. {{.Type|title}}{{.Name}}, with .Name, .Kind, .Exported and the type mappings as data. kind is one of type, func, var and const, a pattern without kind applies to all kinds not having their own. When a fan-out goes to one output, it defaults to the name followed by each replacement for globals depending on the types.")
+	fs.Var((*sliceValue)(&fors), "for", "type mappings `A=B;C=D` of one instance in a fan-out, one output per -for.")
+	fs.Var(mapValue(declares), "d", "rename global A(can be either of Type/Var/Func/Const) to B when `A=B` is passed in. Multiple such mappings are allowed. B can be a pattern like {{.Type|title}}Set for a fan-out.")
+	fs.Var(mapValue(consts), "c", "reassign constant A to value B when `A=B` is passed in. Multiple such mappings are allowed.")
+	fs.Var(mapValue(types), "t", "replace type A to type B when `A=B` is passed in. Multiple such mappings are allowed. B can be a comma separated list for a fan-out, one output per type.")
+	fs.Var(mapValue(methods), "m", "rename method Type.A to B when `Type.A=B` is passed in, including interface methods and their implementations. Multiple such mappings are allowed.")
+	fs.Var(mapValue(fields), "f", "rename field Type.a to b when `Type.a=b` is passed in. Multiple such mappings are allowed.")
+	fs.Var(mapValue(imports), "import", "add new imports. `name=path` specifies that 'name', used in types as name.type, refers to the package living in 'path'.")
+
+	return func() *instance {
+		return &instance{
+			Inputs:       inFiles,
+			Types:        types,
+			Declares:     declares,
+			Consts:       consts,
+			Imports:      imports,
+			Methods:      methods,
+			Fields:       fields,
+			Package:      *packageName,
+			Prefix:       *prefix,
+			Suffix:       *suffix,
+			Output:       *output,
+			Derive:       *derive,
+			NilCmp:       *nilCmp,
+			TypeMethods:  *typeMethods,
+			Keep:         splitList(*keep),
+			Prune:        *pruneOutput,
+			Alias:        *alias,
+			TypeCheck:    *typeCheckOutput,
+			Pkg:          *pkg,
+			GOOS:         *goos,
+			GOARCH:       *goarch,
+			Tags:         *tags,
+			Tests:        *tests,
+			For:          fors,
+			NamePattern:  namePattern,
+			KindPatterns: kindPatterns,
 		}
-		ast.Inspect(expr, func(n ast.Node) bool {
-			switch x := n.(type) {
-			case *ast.SelectorExpr:
-				id := globals.GetIdent(x.X)
-				if id == nil {
-					logger.Instance().Fatal("invalid SelectorExpr", zap.Any("SelectorExpr", x))
-				}
-				importName := id.Name
-				if importMap[importName] == "" && imports[importName] == "" {
-					logger.Instance().Fatal("invalid importName", zap.String("importName", importName), zap.Any("SelectorExpr", x))
-				}
-			}
-			return true
-		})
 	}
-
 }
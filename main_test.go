@@ -0,0 +1,642 @@
+package main
+
+import (
+	"flag"
+	"go/build"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal("MkdirAll", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal("WriteFile", err)
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(dir, "abs", "set.go")
+	path := filepath.Join(dir, "conf", "gg.yaml")
+	writeTestFile(t, path, `instances:
+  - name: stringset
+    inputs: [../tpl/set.go, `+abs+`]
+    types: {Type: string}
+    output: out/stringset.go
+  - inputs: [set.go]
+    pkg: ./tpl
+`)
+
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal("loadManifest", err)
+	}
+	if len(m.Instances) != 2 {
+		t.Fatal("unexpected instances", len(m.Instances))
+	}
+	first, second := m.Instances[0], m.Instances[1]
+	if first.Inputs[0] != filepath.Join(dir, "tpl", "set.go") || first.Inputs[1] != abs {
+		t.Fatal("inputs not relative to the manifest", first.Inputs)
+	}
+	if first.Output != filepath.Join(dir, "conf", "out", "stringset.go") || first.Types["Type"] != "string" {
+		t.Fatal("unexpected instance", first.Output, first.Types)
+	}
+	if second.Name != "#1" || second.Pkg != localPkg(filepath.Join(dir, "conf", "tpl")) {
+		t.Fatal("unexpected instance", second.Name, second.Pkg)
+	}
+
+	dup := filepath.Join(dir, "dup.json")
+	writeTestFile(t, dup, `{"instances": [{"name": "a"}, {"name": "a"}]}`)
+	if _, err = loadManifest(dup); err == nil || !strings.Contains(err.Error(), "duplicate instance name a") {
+		t.Fatal("duplicate name not reported", err)
+	}
+
+	// check was renamed to typecheck, old manifests must not be taken silently
+	old := filepath.Join(dir, "old.yaml")
+	writeTestFile(t, old, "instances:\n  - name: a\n    check: true\n")
+	if _, err = loadManifest(old); err == nil || !strings.Contains(err.Error(), "check") {
+		t.Fatal("unknown yaml key not reported", err)
+	}
+	oldJSON := filepath.Join(dir, "old.json")
+	writeTestFile(t, oldJSON, `{"instances": [{"name": "a", "check": true}]}`)
+	if _, err = loadManifest(oldJSON); err == nil || !strings.Contains(err.Error(), "check") {
+		t.Fatal("unknown json key not reported", err)
+	}
+}
+
+func TestRunManifestEntry(t *testing.T) {
+	dir := t.TempDir()
+	template, err := filepath.Abs("example/container/set/set.go")
+	if err != nil {
+		t.Fatal("Abs", err)
+	}
+	path := filepath.Join(dir, "gg.yaml")
+	writeTestFile(t, path, `instances:
+  - name: good
+    inputs: [`+template+`]
+    types: {Type: string}
+    output: good.go
+  - name: bad
+    inputs: [missing.go]
+    types: {Type: string}
+    output: bad.go
+`)
+
+	if err = runManifest(path, "good"); err != nil {
+		t.Fatal("runManifest good", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "good.go")); err != nil {
+		t.Fatal("output of good not written", err)
+	}
+	if err = runManifest(path, "none"); err == nil || !strings.Contains(err.Error(), "no instance named none") {
+		t.Fatal("unknown entry not reported", err)
+	}
+	if err = runManifest(path, ""); err == nil || !strings.Contains(err.Error(), "failed instances: bad") {
+		t.Fatal("failed instance not reported", err)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	got := splitArgs(`  gg -i set.go -name '{{.Type|title}} {{.Name}}' -d "A=it's"   -t Type=string `)
+	expect := []string{"gg", "-i", "set.go", "-name", "{{.Type|title}} {{.Name}}", "-d", "A=it's", "-t", "Type=string"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatal("unexpected args", got)
+	}
+	if got := splitArgs(`-p ''`); !reflect.DeepEqual(got, []string{"-p", ""}) {
+		t.Fatal("empty quoted arg lost", got)
+	}
+}
+
+func TestFileDirectives(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "set.go")
+	writeTestFile(t, path, `// Package set is a template.
+// run: gg -i set.go -t Type=string -o 'string set.go'
+// run: go generate ./...
+package set
+
+//gg:run -i set.go -t Type=int
+//gg:runner is not a directive
+type Type interface{}
+`)
+	directives, err := fileDirectives(token.NewFileSet(), path)
+	if err != nil {
+		t.Fatal("fileDirectives", err)
+	}
+	if len(directives) != 2 {
+		t.Fatal("unexpected directives", directives)
+	}
+	if !reflect.DeepEqual(directives[0].Args, []string{"-i", "set.go", "-t", "Type=string", "-o", "string set.go"}) || directives[0].Pos.Line != 2 {
+		t.Fatal("unexpected run: directive", directives[0])
+	}
+	if !reflect.DeepEqual(directives[1].Args, []string{"-i", "set.go", "-t", "Type=int"}) || directives[1].Pos.Line != 6 {
+		t.Fatal("unexpected //gg:run directive", directives[1])
+	}
+
+	// directives copied into gg output are skipped
+	generated := filepath.Join(dir, "stringset.go")
+	writeTestFile(t, generated, generatedLine+`
+// run: gg -i set.go -t Type=string
+package set
+`)
+	if directives, err = fileDirectives(token.NewFileSet(), generated); err != nil || len(directives) != 0 {
+		t.Fatal("directives of generated file", directives, err)
+	}
+}
+
+func TestGoFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.go"), "package a\n")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.go"), "package b\n")
+	writeTestFile(t, filepath.Join(dir, ".hidden", "c.go"), "package c\n")
+	writeTestFile(t, filepath.Join(dir, "testdata", "d.go"), "package d\n")
+
+	// the root is named .., which must not be skipped as hidden
+	files, err := goFiles([]string{dir + "/sub/../..."})
+	if err != nil {
+		t.Fatal("goFiles", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	if !reflect.DeepEqual(names, []string{"a.go", "b.go"}) {
+		t.Fatal("unexpected files", names)
+	}
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "tpl", "set.go")
+	writeTestFile(t, template, "package set\n\ntype Type interface{}\n")
+	output := filepath.Join(dir, "out", "set.go")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	newInstance := instanceFlags(fs)
+	err := fs.Parse([]string{
+		"-i", template, "-o", output,
+		"-t", "Type=map[string]int", "-d", `Set={{printf "%sSet" (.Type|word|title)}}`,
+		"-name", "{{.Name}}Of{{.Type|word|title}}", "-name", "func:New {{.Name}}",
+		"-for", "Type=int", "-for", "Type=it's",
+		"-prefix", "X", "-prune",
+	})
+	if err != nil {
+		t.Fatal("Parse", err)
+	}
+	inst := newInstance()
+
+	h, err := header(inst)
+	if err != nil {
+		t.Fatal("header", err)
+	}
+	if !strings.Contains(h, "-i ../tpl/set.go") {
+		t.Fatal("input not relative to the output", h)
+	}
+	writeTestFile(t, output, h+"package set\n")
+
+	gh, err := readHeader(output)
+	if err != nil {
+		t.Fatal("readHeader", err)
+	}
+	if hash, _ := templateHash([]string{template}); gh.Hash != hash {
+		t.Fatal("unexpected hash", gh.Hash)
+	}
+	got, err := headerInstance(output, gh)
+	if err != nil {
+		t.Fatal("headerInstance", err)
+	}
+	if !reflect.DeepEqual(got, inst) {
+		t.Fatalf("instance not reproduced\n%+v\n%+v", got, inst)
+	}
+
+	writeTestFile(t, output, "package set\n")
+	if _, err = readHeader(output); err != ErrNoHeader {
+		t.Fatal("missing header not reported", err)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "tpl", "set.go")
+	writeTestFile(t, template, "package set\n\ntype Type interface{}\n\ntype Set map[Type]struct{}\n")
+	output := filepath.Join(dir, "out", "stringset.go")
+	writeTestFile(t, filepath.Join(dir, "out", "doc.go"), "package set\n")
+
+	inst := &instance{Inputs: []string{template}, Types: map[string]string{"Type": "string"}, Output: output}
+	if err := generate(inst); err != nil {
+		t.Fatal("generate", err)
+	}
+	if _, ok := verifyFile(filepath.Join(dir, "out", "doc.go")); ok {
+		t.Fatal("file without header verified")
+	}
+	status := func() string {
+		r, ok := verifyFile(output)
+		if !ok {
+			t.Fatal("generated file not verified")
+		}
+		return r.Status
+	}
+	if s := status(); s != statusOK {
+		t.Fatal("unexpected status", s)
+	}
+
+	content, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal("ReadFile", err)
+	}
+	writeTestFile(t, output, string(content)+"\n// edited\n")
+	if s := status(); s != statusEdited {
+		t.Fatal("unexpected status", s)
+	}
+
+	writeTestFile(t, output, string(content))
+	writeTestFile(t, template, "package set\n\ntype Type interface{}\n\ntype Set map[Type]bool\n")
+	if s := status(); s != statusTemplateChanged {
+		t.Fatal("unexpected status", s)
+	}
+
+	if err = os.Remove(template); err != nil {
+		t.Fatal("Remove", err)
+	}
+	if s := status(); s != statusError {
+		t.Fatal("unexpected status", s)
+	}
+}
+
+func TestResolveInputs(t *testing.T) {
+	root, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal("Abs", err)
+	}
+	// import paths are resolved against the output, not the working directory
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal("Chdir", err)
+	}
+	defer os.Chdir(root)
+
+	for _, pkg := range []string{filepath.Join(root, "example", "sort"), "github.com/zhiqiangxu/gg/example/sort"} {
+		inst := &instance{Pkg: pkg, Tests: true, Output: filepath.Join(root, "example", "sort", "kofn_int.go")}
+		if err = resolveInputs(inst); err != nil {
+			t.Fatal("resolveInputs", pkg, err)
+		}
+		if len(inst.Inputs) != 1 || filepath.Base(inst.Inputs[0]) != "kofn.go" || len(inst.testInputs) != 1 {
+			t.Fatal("unexpected inputs", inst.Inputs, inst.testInputs)
+		}
+	}
+}
+
+func TestRenderTests(t *testing.T) {
+	inst := &instance{
+		Pkg:    "./example/container/queue/mpsc",
+		Types:  map[string]string{"Something": "int"},
+		Tests:  true,
+		Output: filepath.Join(t.TempDir(), "mpsc_int.go"),
+	}
+	files, err := render(inst)
+	if err != nil {
+		t.Fatal("render", err)
+	}
+	if len(files) != 2 || files[1].Path != testOutput(inst.Output) {
+		t.Fatal("unexpected outputs", len(files))
+	}
+	if !strings.Contains(string(files[0].Content), "// Package mpsc") {
+		t.Fatal("package doc missing from the output")
+	}
+	if strings.Contains(string(files[1].Content), "// Package mpsc") {
+		t.Fatal("package doc repeated in the test output")
+	}
+}
+
+func TestSplitTypes(t *testing.T) {
+	got := splitTypes("int, map[string]int , func(a, b int) (int, error),struct{ a, b int }")
+	expect := []string{"int", "map[string]int", "func(a, b int) (int, error)", "struct{ a, b int }"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatal("unexpected types", got)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	bindings, err := fanOut(&instance{Types: map[string]string{"K": "string,int", "V": "bool, map[int]string", "E": "byte"}})
+	if err != nil {
+		t.Fatal("fanOut", err)
+	}
+	expect := []map[string]string{
+		{"K": "string", "V": "bool", "E": "byte"},
+		{"K": "int", "V": "map[int]string", "E": "byte"},
+	}
+	if !reflect.DeepEqual(bindings, expect) {
+		t.Fatal("unexpected bindings", bindings)
+	}
+
+	if _, err = fanOut(&instance{Types: map[string]string{"K": "string,int", "V": "bool,int,byte"}}); err == nil || !strings.Contains(err.Error(), ErrFanOut.Error()) {
+		t.Fatal("length mismatch not reported", err)
+	}
+	if _, err = fanOut(&instance{Types: map[string]string{"K": "string,int"}, For: []string{"V=int"}}); err == nil || !strings.Contains(err.Error(), ErrFanOut.Error()) {
+		t.Fatal("-for with lists not reported", err)
+	}
+
+	bindings, err = fanOut(&instance{Types: map[string]string{"K": "string"}, For: []string{"V=int", "K=int; V=func(a, b int)"}})
+	if err != nil {
+		t.Fatal("fanOut", err)
+	}
+	expect = []map[string]string{
+		{"K": "string", "V": "int"},
+		{"K": "int", "V": "func(a, b int)"},
+	}
+	if !reflect.DeepEqual(bindings, expect) {
+		t.Fatal("unexpected -for bindings", bindings)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	insts, err := expand(&instance{
+		Types:    map[string]string{"Type": "string,*bytes.Buffer"},
+		Declares: map[string]string{"Set": "{{.Type|word|title}}Set"},
+		Output:   "{{.Type|word|lower}}_set.go",
+	})
+	if err != nil {
+		t.Fatal("expand", err)
+	}
+	if len(insts) != 2 || insts[0].Output != "string_set.go" || insts[1].Output != "buffer_set.go" ||
+		insts[0].Declares["Set"] != "StringSet" || insts[1].Declares["Set"] != "BufferSet" || insts[1].Types["Type"] != "*bytes.Buffer" {
+		t.Fatal("unexpected instances", insts[0], insts[1])
+	}
+
+	// all in one output is combined
+	if insts, err = expand(&instance{Types: map[string]string{"Type": "string,int"}, Output: "sets.go"}); err != nil || len(insts) != 2 {
+		t.Fatal("expand into one output", err)
+	}
+
+	_, err = expand(&instance{
+		Types:  map[string]string{"K": "int"},
+		For:    []string{"V=a", "V=b", "K=string;V=c"},
+		Output: "{{.K}}.go",
+	})
+	if err == nil || !strings.Contains(err.Error(), ErrFanOut.Error()) || !strings.Contains(err.Error(), "output int.go") {
+		t.Fatal("output collision not reported", err)
+	}
+}
+
+func TestPrefixSuffix(t *testing.T) {
+	template := filepath.Join(t.TempDir(), "set.go")
+	writeTestFile(t, template, `package main
+
+type Type interface{}
+
+type StrSet map[Type]struct{}
+
+type I interface{ Len() int }
+
+func (s StrSet) Len() int { return len(s) }
+
+var _ I = StrSet(nil)
+
+func init() {}
+
+func main() {}
+`)
+
+	for _, inst := range []*instance{
+		{Types: map[string]string{"Type": "string"}, Suffix: "X"},
+		{Types: map[string]string{"Type": "string"}, NamePattern: "{{.Name}}X"},
+	} {
+		df, _, err := instantiate(inst, []string{template})
+		if err != nil {
+			t.Fatal("instantiate", err)
+		}
+		content, err := formatFile("", df)
+		if err != nil {
+			t.Fatal("formatFile", err)
+		}
+		output := string(content)
+		for _, s := range []string{"type StrSetX map[string]struct{}", "var _ IX = StrSetX(nil)", "func init()", "func main()"} {
+			if !strings.Contains(output, s) {
+				t.Fatalf("%s missing from\n%s", s, output)
+			}
+		}
+		if strings.Contains(output, "TypeX") {
+			t.Fatalf("replaced type renamed\n%s", output)
+		}
+	}
+}
+
+func TestFindImport(t *testing.T) {
+	dir := t.TempDir()
+	pkgs := map[string]string{
+		"goroot/src/math/rand/rand.go":             "rand",
+		"goroot/src/crypto/rand/rand.go":           "rand",
+		"goroot/src/time/time.go":                  "time",
+		"goroot/src/cmd/util/util.go":              "util",
+		"app/time/time.go":                         "time",
+		"app/util/util.go":                         "util",
+		"app/internal/conv/conv.go":                "conv",
+		"mod/dep@v2.0.0/dep.go":                    "dep",
+		"mod/dep@v2.0.0/util/util.go":              "util",
+		"mod/dep@v2.0.0/internal/secret/secret.go": "secret",
+		"mod/dep@v2.0.0/testdata/fixture/f.go":     "fixture",
+		"mod/dep@v2.0.0/go-yaml/yaml.go":           "yaml",
+		"mod/dep@v2.0.0/mismatch/mismatch.go":      "other",
+		"mod/dep@v2.0.0/nested/go.mod":             "",
+		"mod/dep@v2.0.0/nested/nested/nested.go":   "nested",
+	}
+	for path, name := range pkgs {
+		content := "package " + name + "\n"
+		if name == "" {
+			content = "module example.com/nested\n"
+		}
+		writeTestFile(t, filepath.Join(dir, filepath.FromSlash(path)), content)
+	}
+	roots := []pkgRoot{
+		{dir: filepath.Join(dir, "goroot", "src"), std: true},
+		{dir: filepath.Join(dir, "app"), path: "example.com/app", main: true},
+		{dir: filepath.Join(dir, "mod", "dep@v2.0.0"), path: "example.com/dep/v2"},
+	}
+	ctx := build.Default
+
+	for name, expect := range map[string]string{
+		// the standard library first, then the main module, then its requirements
+		"time": "time",
+		"util": "example.com/app/util",
+		"conv": "example.com/app/internal/conv",
+		"dep":  "example.com/dep/v2",
+		"yaml": "example.com/dep/v2/go-yaml",
+	} {
+		path, err := findImport(&ctx, roots, name)
+		if err != nil || path != expect {
+			t.Fatal("unexpected import", name, path, err)
+		}
+	}
+
+	for _, name := range []string{"secret", "fixture", "mismatch", "other", "nested"} {
+		if _, err := findImport(&ctx, roots, name); err == nil || !strings.Contains(err.Error(), ErrImportNotFound.Error()) {
+			t.Fatal("package should not be found", name, err)
+		}
+	}
+
+	_, err := findImport(&ctx, roots, "rand")
+	if err == nil || !strings.Contains(err.Error(), ErrAmbiguousImport.Error()+" rand: crypto/rand, math/rand, use -import rand=path") {
+		t.Fatal("ambiguity not reported", err)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	template := filepath.Join(t.TempDir(), "list.go")
+	writeTestFile(t, template, `package list
+
+// X is the element type
+type X interface{}
+
+type List struct{ v X }
+
+func NewList(v X) *List { return &List{v: v} }
+`)
+
+	for _, c := range []struct {
+		inst   *instance
+		expect []string
+	}{
+		{
+			&instance{Types: map[string]string{"X": "int"}, Prefix: "P", NamePattern: "{{.Name}}Of", Alias: true},
+			[]string{"type X = int", "type PListOf struct{ v X }", "func PNewListOf(v X) *PListOf"},
+		},
+		{
+			&instance{Types: map[string]string{"X": "time.Duration"}, Imports: map[string]string{"time": "time"}, Alias: true},
+			[]string{"import (\n\t\"time\"\n)", "type X = time.Duration", "type List struct{ v X }"},
+		},
+	} {
+		df, _, err := instantiate(c.inst, []string{template})
+		if err != nil {
+			t.Fatal("instantiate", err)
+		}
+		content, err := formatFile("", df)
+		if err != nil {
+			t.Fatal("formatFile", err)
+		}
+		for _, s := range c.expect {
+			if !strings.Contains(string(content), s) {
+				t.Fatalf("%s missing from\n%s", s, content)
+			}
+		}
+	}
+}
+
+func TestTypeCheckLines(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "tpl", "less.go")
+	writeTestFile(t, template, `package less
+
+// DT for data type
+type DT uint64
+
+// Less compares a and b
+func Less(a, b DT) bool {
+	return a < b
+}
+`)
+	output := filepath.Join(dir, "out", "less.go")
+
+	for _, types := range []string{"bool", "int,bool"} {
+		// the reported lines are those of the file written
+		files, err := renderAll(&instance{Inputs: []string{template}, Types: map[string]string{"DT": types}, Output: output})
+		if err != nil || len(files) != 1 {
+			t.Fatal("renderAll", err)
+		}
+		lines := strings.Split(string(files[0].Content), "\n")
+
+		stderr := os.Stderr
+		f, err := ioutil.TempFile(dir, "stderr")
+		if err != nil {
+			t.Fatal("TempFile", err)
+		}
+		os.Stderr = f
+		_, err = renderAll(&instance{Inputs: []string{template}, Types: map[string]string{"DT": types}, Output: output, TypeCheck: true})
+		os.Stderr = stderr
+		f.Close()
+		if err == nil || !strings.Contains(err.Error(), ErrTypeCheck.Error()) {
+			t.Fatal("type error not reported", err)
+		}
+
+		reported, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal("ReadFile", err)
+		}
+		prefix := "(generated " + output + ":"
+		i := strings.Index(string(reported), prefix)
+		if i < 0 {
+			t.Fatal("generated position missing", string(reported))
+		}
+		pos := strings.SplitN(string(reported[i+len(prefix):]), ":", 2)
+		line, err := strconv.Atoi(pos[0])
+		if err != nil || line < 1 || line > len(lines) || !strings.Contains(lines[line-1], "a < b") {
+			t.Fatalf("line %s doesn't hold the error\n%s", pos[0], files[0].Content)
+		}
+	}
+}
+
+func TestDropTypeMethods(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "greet.go")
+	writeTestFile(t, template, `package greet
+
+// T is the placeholder
+type T struct{}
+
+// Hello method
+func (t *T) Hello() string { return "hello" }
+
+// Bye method
+func (t T) Bye() string { return t.Hello() }
+
+type wrapper struct{ *T }
+
+// Greet greets
+func Greet(w wrapper) string {
+	return w.Hello()
+}
+
+var bye = T.Bye
+`)
+
+	_, _, err := instantiate(&instance{Types: map[string]string{"T": "int"}, TypeMethods: "drop"}, []string{template})
+	if err == nil || !strings.Contains(err.Error(), ErrTypeMethods.Error()) ||
+		!strings.Contains(err.Error(), "greet.go:16:11: Hello, "+template+":19:13: Bye") {
+		t.Fatal("uses of dropped methods not reported", err)
+	}
+
+	// uses within the dropped methods don't count
+	template = filepath.Join(dir, "unused", "greet.go")
+	writeTestFile(t, template, `package greet
+
+// T is the placeholder
+type T struct{}
+
+// Hello method
+func (t *T) Hello() string { return "hello" }
+
+// Bye method
+func (t T) Bye() string { return t.Hello() }
+
+// Greet greets
+func Greet(v T) T { return v }
+`)
+	df, _, err := instantiate(&instance{Types: map[string]string{"T": "int"}, TypeMethods: "drop"}, []string{template})
+	if err != nil {
+		t.Fatal("instantiate", err)
+	}
+	content, err := formatFile("", df)
+	if err != nil {
+		t.Fatal("formatFile", err)
+	}
+	if strings.Contains(string(content), "Hello") || strings.Contains(string(content), "Bye") {
+		t.Fatal("methods not dropped", string(content))
+	}
+}
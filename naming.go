@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/zhiqiangxu/gg/pkg/globals"
+)
+
+// patternKinds are the kinds of globals a -name pattern can be specific to
+var patternKinds = map[string]globals.SymKind{
+	"type":  globals.KindType,
+	"func":  globals.KindFunc,
+	"var":   globals.KindVar,
+	"const": globals.KindConst,
+}
+
+// namePatternsValue implements flag.Value for `-name [kind:]pattern`,
+// a pattern without kind applies to all kinds not having their own.
+type namePatternsValue struct {
+	all   *string
+	kinds map[string]string
+}
+
+func (v namePatternsValue) String() string {
+	if v.all == nil {
+		return ""
+	}
+	var list []string
+	if *v.all != "" {
+		list = append(list, *v.all)
+	}
+	for _, kind := range sortedKeys(v.kinds) {
+		list = append(list, kind+":"+v.kinds[kind])
+	}
+	return strings.Join(list, ",")
+}
+
+func (v namePatternsValue) Set(s string) error {
+	if sep := strings.Index(s, ":"); sep != -1 {
+		if _, ok := patternKinds[s[:sep]]; ok {
+			v.kinds[s[:sep]] = s[sep+1:]
+			return nil
+		}
+	}
+	*v.all = s
+	return nil
+}
+
+// namePattern returns the -name pattern for globals of kind, empty if none
+func (inst *instance) namePattern(kind globals.SymKind) string {
+	if pattern, ok := inst.KindPatterns[kind.String()]; ok {
+		return pattern
+	}
+	return inst.NamePattern
+}
+
+// globalName executes the -name pattern for a global of kind, the name is kept if there's no pattern
+func (inst *instance) globalName(name string, kind globals.SymKind, types map[string]string) (string, error) {
+	pattern := inst.namePattern(kind)
+	if pattern == "" {
+		return name, nil
+	}
+	return expandName(pattern, name, kind, types)
+}
+
+// reservedName reports whether a global of package pkg must keep its name, i.e., the blank identifier,
+// init functions, and main of package main
+func reservedName(name string, kind globals.SymKind, pkg string) bool {
+	switch {
+	case name == "_":
+		return true
+	case kind == globals.KindFunc && name == "init":
+		return true
+	case kind == globals.KindFunc && name == "main" && pkg == "main":
+		return true
+	}
+	return false
+}
+
+// expandName executes the name pattern for a global, with .Name, .Kind, .Exported and the type mappings as data
+func expandName(pattern, name string, kind globals.SymKind, types map[string]string) (s string, err error) {
+	data := map[string]interface{}{}
+	for k, v := range types {
+		data[k] = v
+	}
+	data["Name"] = name
+	data["Kind"] = kind.String()
+	data["Exported"] = ast.IsExported(name)
+
+	if s, err = expandPattern(pattern, data); err != nil {
+		return
+	}
+	if !isIdent(s) {
+		err = fmt.Errorf("pattern %s gives invalid name %q for %s", pattern, s, name)
+	}
+	return
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// camel joins the words of s in lower camel case, e.g. stringSet for string_set or StringSet
+func camel(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		if i == 0 {
+			words[i] = lowerFirst(w)
+		} else {
+			words[i] = upperFirst(w)
+		}
+	}
+	return strings.Join(words, "")
+}
+
+func upperFirst(s string) string {
+	for _, r := range s {
+		return string(unicode.ToUpper(r)) + s[len(string(r)):]
+	}
+	return s
+}
+
+func lowerFirst(s string) string {
+	for _, r := range s {
+		return string(unicode.ToLower(r)) + s[len(string(r)):]
+	}
+	return s
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
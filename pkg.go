@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"go/build"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrInputConflict when both -i and -pkg are specified
+	ErrInputConflict = errors.New("-i and -pkg are mutually exclusive")
+	// ErrNoTests when -tests is specified but the template has no test files
+	ErrNoTests = errors.New("no test files in template")
+)
+
+// resolveInputs fills the template files of inst from -pkg, along with the test files for -tests,
+// it's a no-op if already resolved
+func resolveInputs(inst *instance) (err error) {
+	if inst.resolved {
+		return
+	}
+
+	ctx := buildContext(inst)
+	switch {
+	case inst.Pkg != "":
+		if len(inst.Inputs) > 0 {
+			return ErrInputConflict
+		}
+
+		var bp *build.Package
+		if isLocalPkg(inst.Pkg) {
+			bp, err = ctx.ImportDir(inst.Pkg, 0)
+		} else {
+			// import paths are resolved in the module of the output, wherever gg runs
+			if ctx.Dir, err = filepath.Abs(outputDir(inst)); err != nil {
+				return
+			}
+			bp, err = ctx.Import(inst.Pkg, ctx.Dir, 0)
+		}
+		if err != nil {
+			return
+		}
+		for _, name := range bp.GoFiles {
+			inst.Inputs = append(inst.Inputs, filepath.Join(bp.Dir, name))
+		}
+		for _, name := range bp.TestGoFiles {
+			inst.testInputs = append(inst.testInputs, filepath.Join(bp.Dir, name))
+		}
+	case inst.Tests:
+		// the test files in the directories of the input files
+		seen := make(map[string]bool)
+		for _, input := range inst.Inputs {
+			dir := filepath.Dir(input)
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+
+			var bp *build.Package
+			bp, err = ctx.ImportDir(dir, 0)
+			if err != nil {
+				return
+			}
+			for _, name := range bp.TestGoFiles {
+				inst.testInputs = append(inst.testInputs, filepath.Join(dir, name))
+			}
+		}
+	}
+	inst.resolved = true
+	return
+}
+
+// buildContext returns the context for build constraints of inst
+func buildContext(inst *instance) build.Context {
+	ctx := build.Default
+	if inst.GOOS != "" {
+		ctx.GOOS = inst.GOOS
+	}
+	if inst.GOARCH != "" {
+		ctx.GOARCH = inst.GOARCH
+	}
+	if inst.Tags != "" {
+		ctx.BuildTags = strings.Split(inst.Tags, ",")
+	}
+	return ctx
+}
+
+// isLocalPkg tells whether pkg is a directory rather than an import path
+func isLocalPkg(pkg string) bool {
+	return build.IsLocalImport(pkg) || filepath.IsAbs(pkg)
+}
+
+// localPkg makes sure dir is taken as a directory rather than an import path
+func localPkg(dir string) string {
+	if isLocalPkg(dir) {
+		return dir
+	}
+	return "./" + dir
+}
+
+// templateInputs returns all template files which the outputs of inst depend on
+func templateInputs(inst *instance) []string {
+	if !inst.Tests {
+		return inst.Inputs
+	}
+	return append(append([]string(nil), inst.Inputs...), inst.testInputs...)
+}
+
+// testOutput returns the output for the instantiated test files, `<output>_test.go`
+func testOutput(output string) string {
+	if output == "" {
+		return ""
+	}
+	return strings.TrimSuffix(output, ".go") + "_test.go"
+}
@@ -0,0 +1,162 @@
+// Package check type checks generated code and maps errors back to the template
+package check
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Error is a type error found in generated code
+type Error struct {
+	Msg string
+	// Generated is the position in generated code
+	Generated token.Position
+	// Template is the position in the template, invalid if unknown
+	Template token.Position
+}
+
+func (e Error) String() string {
+	if e.Template.IsValid() {
+		return fmt.Sprintf("%s: %s (generated %s)", e.Template, e.Msg, e.Generated)
+	}
+	return fmt.Sprintf("%s: %s", e.Generated, e.Msg)
+}
+
+// File type checks df as it will be written to filename, other files of the same package
+// in the directory of filename are checked together with it.
+// Packages are imported from source, so stdlib and module packages available offline can be used.
+//
+// templatePos maps nodes of df to their positions in the template.
+func File(df *dst.File, filename string, templatePos func(dst.Node) token.Position) (errs []Error, err error) {
+	r := decorator.NewRestorer()
+	fr := r.FileRestorer()
+	if filename != "" {
+		if fr.Name, err = filepath.Abs(filename); err != nil {
+			return
+		}
+	}
+	rf, err := fr.RestoreFile(df)
+	if err != nil {
+		return
+	}
+
+	// positions of the restored file don't match the formatted output,
+	// so check the output itself and relate its nodes to the restored ones by structure
+	var buf bytes.Buffer
+	if err = format.Node(&buf, r.Fset, rf); err != nil {
+		return
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fr.Name, buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		return
+	}
+	restored := make(map[ast.Node]ast.Node)
+	if rnodes, nodes := nodeList(rf), nodeList(f); len(rnodes) == len(nodes) {
+		for i, n := range nodes {
+			restored[n] = rnodes[i]
+		}
+	}
+
+	files := []*ast.File{f}
+	if filename != "" {
+		var siblings []*ast.File
+		siblings, err = packageFiles(fset, fr.Name, df.Name.Name)
+		if err != nil {
+			return
+		}
+		files = append(files, siblings...)
+	}
+
+	tf := fset.File(f.Pos())
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(e error) {
+			te, ok := e.(types.Error)
+			if !ok || fset.File(te.Pos) != tf {
+				return
+			}
+			errs = append(errs, Error{
+				Msg:       te.Msg,
+				Generated: fset.Position(te.Pos),
+				Template:  templatePosOf(f, te.Pos, func(n ast.Node) dst.Node { return r.Dst.Nodes[restored[n]] }, templatePos),
+			})
+		},
+	}
+	// errors are collected by conf.Error
+	conf.Check(df.Name.Name, fset, files, nil)
+
+	return
+}
+
+// templatePosOf finds the innermost node enclosing pos which comes from the template
+func templatePosOf(f *ast.File, pos token.Pos, dstNode func(ast.Node) dst.Node, templatePos func(dst.Node) token.Position) token.Position {
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	for _, n := range path {
+		dn := dstNode(n)
+		if dn == nil {
+			continue
+		}
+		if p := templatePos(dn); p.IsValid() {
+			return p
+		}
+	}
+	return token.Position{}
+}
+
+// nodeList returns all nodes of f except comments in depth-first order,
+// comments are skipped since the restorer doesn't attach them as the parser does
+func nodeList(f *ast.File) (nodes []ast.Node) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n.(type) {
+		case nil:
+		case *ast.CommentGroup, *ast.Comment:
+			return false
+		default:
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	return
+}
+
+// packageFiles parses the non-test go files of package pkgName in the directory of filename, except filename itself
+func packageFiles(fset *token.FileSet, filename, pkgName string) (files []*ast.File, err error) {
+	dir := filepath.Dir(filename)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		// the output directory may not exist yet
+		err = nil
+		return
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		path := filepath.Join(dir, name)
+		if info.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || path == filename {
+			continue
+		}
+		var f *ast.File
+		f, err = parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return
+		}
+		if f.Name.Name == pkgName {
+			files = append(files, f)
+		}
+	}
+	return
+}
@@ -0,0 +1,235 @@
+package check
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+
+	"github.com/zhiqiangxu/gg/pkg/globals"
+)
+
+// ConstraintDirective is the comment directive to declare constraints on a placeholder type, e.g.
+//
+//	// DT for data type
+//	//gg:constraint ordered
+//	type DT uint64
+//
+// Built-in constraints are comparable, ordered, integer, signed, unsigned, float, numeric
+// and `samesize T`, which requires the same size as the replacement of placeholder T.
+// Anything else is an interface the replacement must implement, either an interface type
+// like fmt.Stringer, or a method list like `Len() int; Less(i, j int) bool`.
+const ConstraintDirective = "//gg:constraint "
+
+// builtinConstraints checks the predeclared constraints
+var builtinConstraints = map[string]func(t types.Type) bool{
+	"comparable": types.Comparable,
+	"ordered":    basicInfo(types.IsOrdered),
+	"integer":    basicInfo(types.IsInteger),
+	"signed": func(t types.Type) bool {
+		return basicInfo(types.IsInteger)(t) && !basicInfo(types.IsUnsigned)(t)
+	},
+	"unsigned": basicInfo(types.IsUnsigned),
+	"float":    basicInfo(types.IsFloat),
+	"numeric":  basicInfo(types.IsNumeric),
+}
+
+func basicInfo(info types.BasicInfo) func(t types.Type) bool {
+	return func(t types.Type) bool {
+		b, ok := t.Underlying().(*types.Basic)
+		return ok && b.Info()&info != 0
+	}
+}
+
+// ConstraintsOf collects the constraints declared for each type in df
+func ConstraintsOf(df *dst.File) map[string][]string {
+	m := make(map[string][]string)
+	collect := func(name string, decs ...dst.Decorations) {
+		for _, ds := range decs {
+			for _, d := range ds {
+				if strings.HasPrefix(d, ConstraintDirective) {
+					m[name] = append(m[name], strings.TrimSpace(strings.TrimPrefix(d, ConstraintDirective)))
+				}
+			}
+		}
+	}
+
+	for _, d := range df.Decls {
+		gd, ok := d.(*dst.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range gd.Specs {
+			s := s.(*dst.TypeSpec)
+			if len(gd.Specs) == 1 {
+				collect(s.Name.Name, gd.Decs.Start)
+			}
+			collect(s.Name.Name, s.Decs.Start, s.Decs.End)
+		}
+	}
+	return m
+}
+
+// Constraints checks the replacement of each placeholder type in typeMap against
+// its declared constraints, this should be done before df is rewritten.
+//
+// imports maps import name to path for packages used by replacements but not imported by df.
+func Constraints(df *dst.File, typeMap map[string]string, imports map[string]string) (err error) {
+	constraints := ConstraintsOf(df)
+
+	var placeholders []string
+	for name := range typeMap {
+		if len(constraints[name]) > 0 {
+			placeholders = append(placeholders, name)
+		}
+	}
+	if len(placeholders) == 0 {
+		return
+	}
+	sort.Strings(placeholders)
+
+	resolved, err := resolveTypes(df, typeMap, imports, constraints)
+	if err != nil {
+		return
+	}
+
+	sizes := types.SizesFor("gc", runtime.GOARCH)
+	var failures []string
+	for _, name := range placeholders {
+		t := resolved[typeMap[name]]
+		if t == nil {
+			failures = append(failures, fmt.Sprintf("%s=%s: can not resolve type", name, typeMap[name]))
+			continue
+		}
+		for _, c := range constraints[name] {
+			var ok bool
+			switch {
+			case builtinConstraints[c] != nil:
+				ok = builtinConstraints[c](t)
+			case strings.HasPrefix(c, "samesize "):
+				other := strings.TrimSpace(strings.TrimPrefix(c, "samesize "))
+				ot := resolved[typeMap[other]]
+				if ot == nil {
+					// not replaced, compare with the placeholder itself
+					ot = resolved[other]
+				}
+				ok = ot != nil && sizes.Sizeof(t) == sizes.Sizeof(ot)
+			default:
+				if ct := resolved[c]; ct != nil {
+					iface, _ := ct.Underlying().(*types.Interface)
+					ok = iface != nil && types.Implements(t, iface)
+				}
+			}
+			if !ok {
+				failures = append(failures, fmt.Sprintf("%s=%s does not satisfy constraint %s", name, typeMap[name], c))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		err = fmt.Errorf("constraint check failed: %s", strings.Join(failures, "; "))
+	}
+
+	return
+}
+
+// resolveTypes type checks df along with a file declaring a variable for each
+// replacement type and interface constraint, and returns their types by expression.
+func resolveTypes(df *dst.File, typeMap map[string]string, imports map[string]string, constraints map[string][]string) (resolved map[string]types.Type, err error) {
+	fset, f, err := decorator.RestoreFile(df)
+	if err != nil {
+		return
+	}
+
+	var exprs []string
+	seen := make(map[string]bool)
+	add := func(expr string) {
+		if !seen[expr] {
+			seen[expr] = true
+			exprs = append(exprs, expr)
+		}
+	}
+	for name, target := range typeMap {
+		add(target)
+		// placeholders are needed for samesize when not replaced
+		add(name)
+	}
+	for _, cs := range constraints {
+		for _, c := range cs {
+			switch {
+			case builtinConstraints[c] != nil:
+			case strings.HasPrefix(c, "samesize "):
+				add(strings.TrimSpace(strings.TrimPrefix(c, "samesize ")))
+			default:
+				add(c)
+			}
+		}
+	}
+
+	// declarations live in a separate file, so imports are all put there
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", df.Name.Name)
+	importMap := globals.GetImportMap(f)
+	for name, path := range imports {
+		importMap[name] = path
+	}
+	for name, path := range importMap {
+		if name != "_" && name != "." {
+			fmt.Fprintf(&buf, "import %s %s\n", name, strconv.Quote(path))
+		}
+	}
+	vars := make(map[string]string)
+	for i, expr := range exprs {
+		if !isTypeExpr(expr) {
+			expr = "interface{ " + expr + " }"
+		}
+		v := fmt.Sprintf("ggResolve%d", i)
+		vars[v] = exprs[i]
+		fmt.Fprintf(&buf, "var %s %s\n", v, expr)
+	}
+
+	rf, err := parser.ParseFile(fset, "gg_resolve.go", buf.Bytes(), 0)
+	if err != nil {
+		return
+	}
+
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		// errors in the template itself are not our business here
+		Error: func(error) {},
+	}
+	// errors are ignored by conf.Error
+	conf.Check(df.Name.Name, fset, []*ast.File{f, rf}, info)
+
+	resolved = make(map[string]types.Type)
+	for id, obj := range info.Defs {
+		expr, ok := vars[id.Name]
+		if !ok || obj == nil {
+			continue
+		}
+		if t := obj.Type(); t != nil && t != types.Typ[types.Invalid] {
+			resolved[expr] = t
+		}
+	}
+	return
+}
+
+// isTypeExpr reports whether s is a type expression, otherwise it's a method list
+func isTypeExpr(s string) bool {
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		return false
+	}
+	_, isCall := expr.(*ast.CallExpr)
+	return !isCall
+}
@@ -0,0 +1,132 @@
+package check
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+	"runtime"
+
+	"github.com/dave/dst"
+
+	"github.com/zhiqiangxu/gg/pkg/globals"
+)
+
+// Literal is a literal used as a value of a placeholder type which its replacement can not represent
+type Literal struct {
+	// Lit is the literal node in df
+	Lit dst.Expr
+	// Value is the literal as written, e.g. -1
+	Value string
+	// TypeName is the placeholder type
+	TypeName string
+	// Target is the replacement type
+	Target string
+}
+
+// Literals finds literals used as values of placeholder types in typeMap which their
+// replacements can not represent, e.g. 300 for uint8 or "a" for int.
+// This should be done before df is rewritten, imports is the same as in Constraints.
+func Literals(df *dst.File, typeMap map[string]string, imports map[string]string) (lits []Literal, err error) {
+	var placeholders []string
+	for name := range typeMap {
+		placeholders = append(placeholders, name)
+	}
+	uses := globals.FindLiterals(df, placeholders)
+	if len(uses) == 0 {
+		return
+	}
+
+	resolved, err := resolveTypes(df, typeMap, imports, nil)
+	if err != nil {
+		return
+	}
+
+	sizes := types.SizesFor("gc", runtime.GOARCH)
+	for _, use := range uses {
+		target := typeMap[use.TypeName]
+		t := resolved[target]
+		if t == nil {
+			// can't tell
+			continue
+		}
+		value, text := literalValue(use.Lit)
+		if value.Kind() == constant.Unknown || representable(value, t, sizes) {
+			continue
+		}
+		lits = append(lits, Literal{Lit: use.Lit, Value: text, TypeName: use.TypeName, Target: target})
+	}
+	return
+}
+
+// literalValue returns the constant value of a basic literal, possibly signed, along with its text
+func literalValue(e dst.Expr) (value constant.Value, text string) {
+	switch x := e.(type) {
+	case *dst.BasicLit:
+		return constant.MakeFromLiteral(x.Value, x.Kind, 0), x.Value
+	case *dst.UnaryExpr:
+		value, text = literalValue(x.X)
+		return constant.UnaryOp(x.Op, value, 0), x.Op.String() + text
+	}
+	return constant.MakeUnknown(), ""
+}
+
+// representable tells whether the untyped constant v can be used as a value of type t
+func representable(v constant.Value, t types.Type, sizes types.Sizes) bool {
+	switch u := t.Underlying().(type) {
+	case *types.Interface:
+		return types.Implements(defaultType(v), u)
+	case *types.Basic:
+		info := u.Info()
+		switch {
+		case info&types.IsInteger != 0:
+			x := constant.ToInt(v)
+			if x.Kind() != constant.Int {
+				return false
+			}
+			bits := int(8 * sizes.Sizeof(u))
+			if info&types.IsUnsigned != 0 {
+				return constant.Sign(x) >= 0 && constant.BitLen(x) <= bits
+			}
+			if constant.Sign(x) < 0 {
+				// -2^(bits-1) <= x, i.e., -x-1 < 2^(bits-1)
+				x = constant.BinaryOp(constant.UnaryOp(token.SUB, x, 0), token.SUB, constant.MakeInt64(1))
+			}
+			return constant.BitLen(x) <= bits-1
+		case info&types.IsFloat != 0:
+			x := constant.ToFloat(v)
+			if x.Kind() == constant.Unknown {
+				return false
+			}
+			f, _ := constant.Float64Val(x)
+			if u.Kind() == types.Float32 {
+				return math.Abs(f) <= math.MaxFloat32
+			}
+			return !math.IsInf(f, 0)
+		case info&types.IsComplex != 0:
+			return constant.ToComplex(v).Kind() != constant.Unknown
+		case info&types.IsString != 0:
+			return v.Kind() == constant.String
+		case info&types.IsBoolean != 0:
+			return v.Kind() == constant.Bool
+		}
+	}
+	return false
+}
+
+// defaultType is the type of the untyped constant v when used as an interface value
+func defaultType(v constant.Value) types.Type {
+	switch v.Kind() {
+	case constant.Bool:
+		return types.Typ[types.Bool]
+	case constant.String:
+		return types.Typ[types.String]
+	case constant.Int:
+		return types.Typ[types.Int]
+	case constant.Float:
+		return types.Typ[types.Float64]
+	case constant.Complex:
+		return types.Typ[types.Complex128]
+	}
+	return types.Typ[types.Invalid]
+}
@@ -0,0 +1,167 @@
+package generic
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/dave/dst"
+)
+
+// level is how much a type parameter is required to support, each level implies the ones before
+type level int
+
+const (
+	levelAny level = iota
+	levelComparable
+	levelOrdered
+	levelNumeric
+	levelInteger
+)
+
+var (
+	integerTypes  = []string{"int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr"}
+	signedTypes   = []string{"int", "int8", "int16", "int32", "int64"}
+	unsignedTypes = []string{"uint", "uint8", "uint16", "uint32", "uint64", "uintptr"}
+	floatTypes    = []string{"float32", "float64"}
+)
+
+// opLevel is what an operator requires from its operands
+func opLevel(op token.Token) level {
+	switch op {
+	case token.EQL, token.NEQ:
+		return levelComparable
+	case token.LSS, token.LEQ, token.GTR, token.GEQ, token.ADD, token.ADD_ASSIGN:
+		// all ordered types support +
+		return levelOrdered
+	case token.SUB, token.MUL, token.QUO, token.SUB_ASSIGN, token.MUL_ASSIGN, token.QUO_ASSIGN, token.INC, token.DEC:
+		return levelNumeric
+	case token.REM, token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT,
+		token.REM_ASSIGN, token.AND_ASSIGN, token.OR_ASSIGN, token.XOR_ASSIGN, token.SHL_ASSIGN, token.SHR_ASSIGN, token.AND_NOT_ASSIGN:
+		return levelInteger
+	}
+	return levelAny
+}
+
+// inferLevels finds out what each placeholder type is required to support from how its values are used
+func inferLevels(files []*ast.File, info *types.Info, placeholders map[types.Type]string) map[string]level {
+	levels := make(map[string]level)
+	require := func(e ast.Expr, l level) {
+		tv, ok := info.Types[e]
+		if !ok {
+			return
+		}
+		if name, ok := placeholders[tv.Type]; ok && l > levels[name] {
+			levels[name] = l
+		}
+	}
+
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.BinaryExpr:
+				require(x.X, opLevel(x.Op))
+				require(x.Y, opLevel(x.Op))
+			case *ast.UnaryExpr:
+				if x.Op == token.SUB {
+					require(x.X, levelNumeric)
+				} else if x.Op == token.XOR {
+					require(x.X, levelInteger)
+				}
+			case *ast.AssignStmt:
+				if x.Tok != token.ASSIGN && x.Tok != token.DEFINE {
+					for _, lhs := range x.Lhs {
+						require(lhs, opLevel(x.Tok))
+					}
+				}
+			case *ast.IncDecStmt:
+				require(x.X, opLevel(x.Tok))
+			case *ast.MapType:
+				require(x.Key, levelComparable)
+			case *ast.SwitchStmt:
+				if x.Tag != nil {
+					require(x.Tag, levelComparable)
+				}
+			}
+			return true
+		})
+	}
+	return levels
+}
+
+// levelConstraint returns the constraint expression for a level
+func levelConstraint(l level) dst.Expr {
+	switch l {
+	case levelComparable:
+		return dst.NewIdent("comparable")
+	case levelOrdered:
+		return &dst.SelectorExpr{X: dst.NewIdent("cmp"), Sel: dst.NewIdent("Ordered")}
+	case levelNumeric:
+		return union(append(append([]string(nil), integerTypes...), floatTypes...))
+	case levelInteger:
+		return union(integerTypes)
+	}
+	return dst.NewIdent("any")
+}
+
+// directiveConstraint returns the constraint expression for a //gg:constraint directive,
+// ok is false if it can't be expressed with generics
+func directiveConstraint(c string) (e dst.Expr, ok bool) {
+	switch c {
+	case "comparable":
+		return levelConstraint(levelComparable), true
+	case "ordered":
+		return levelConstraint(levelOrdered), true
+	case "numeric":
+		return levelConstraint(levelNumeric), true
+	case "integer":
+		return levelConstraint(levelInteger), true
+	case "signed":
+		return union(signedTypes), true
+	case "unsigned":
+		return union(unsignedTypes), true
+	case "float":
+		return union(floatTypes), true
+	}
+	if strings.HasPrefix(c, "samesize ") {
+		return nil, false
+	}
+	// an interface type, or a method list
+	e, err := parseExpr(c)
+	if _, isCall := e.(*dst.CallExpr); err != nil || isCall {
+		if e, err = parseExpr("interface{ " + c + " }"); err != nil {
+			return nil, false
+		}
+	}
+	return e, true
+}
+
+// directiveLevel returns the level a //gg:constraint directive guarantees
+func directiveLevel(c string) level {
+	switch c {
+	case "comparable":
+		return levelComparable
+	case "ordered":
+		return levelOrdered
+	case "numeric", "signed", "unsigned", "float":
+		return levelNumeric
+	case "integer":
+		return levelInteger
+	}
+	return levelAny
+}
+
+// union returns ~t1 | ~t2 | ...
+func union(names []string) dst.Expr {
+	var e dst.Expr
+	for _, name := range names {
+		term := &dst.UnaryExpr{Op: token.TILDE, X: dst.NewIdent(name)}
+		if e == nil {
+			e = term
+		} else {
+			e = &dst.BinaryExpr{X: e, Op: token.OR, Y: term}
+		}
+	}
+	return e
+}
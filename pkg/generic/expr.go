@@ -0,0 +1,90 @@
+package generic
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+)
+
+// parseExpr parses s into a dst expression
+func parseExpr(s string) (e dst.Expr, err error) {
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", s, 0)
+	if err != nil {
+		return
+	}
+	n, err := decorator.NewDecorator(fset).DecorateNode(expr)
+	if err != nil {
+		return
+	}
+	e = n.(dst.Expr)
+	return
+}
+
+// exprString returns the source of e in canonical form, e.g. map[string]int
+func exprString(e dst.Expr) string {
+	// an expression can only be restored within a file
+	df := &dst.File{
+		Name: dst.NewIdent("p"),
+		Decls: []dst.Decl{&dst.GenDecl{Tok: token.VAR, Specs: []dst.Spec{&dst.ValueSpec{
+			Names: []*dst.Ident{dst.NewIdent("_")},
+			Type:  dst.Clone(e).(dst.Expr),
+		}}}},
+	}
+	fset, f, err := decorator.RestoreFile(df)
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Type)
+	return buf.String()
+}
+
+// canonical returns the type expression s in canonical form
+func canonical(s string) (string, error) {
+	e, err := parseExpr(s)
+	if err != nil {
+		return "", err
+	}
+	return exprString(e), nil
+}
+
+// word returns the identifier naming a type expression, e.g. Item for *pkg.Item, int for []int
+func word(e dst.Expr) string {
+	for {
+		switch x := e.(type) {
+		case *dst.Ident:
+			return x.Name
+		case *dst.SelectorExpr:
+			return x.Sel.Name
+		case *dst.StarExpr:
+			e = x.X
+		case *dst.ParenExpr:
+			e = x.X
+		case *dst.ArrayType:
+			e = x.Elt
+		case *dst.MapType:
+			e = x.Value
+		case *dst.ChanType:
+			e = x.Value
+		case *dst.IndexExpr:
+			e = x.X
+		case *dst.IndexListExpr:
+			e = x.X
+		default:
+			return ""
+		}
+	}
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
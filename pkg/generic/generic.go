@@ -0,0 +1,452 @@
+// Package generic converts gg templates into Go generics
+package generic
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/token"
+	"go/types"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/dstutil"
+
+	"github.com/zhiqiangxu/gg/pkg/check"
+	"github.com/zhiqiangxu/gg/pkg/globals"
+)
+
+var (
+	// ErrPlaceholder when a placeholder is not a type declared by the template
+	ErrPlaceholder = errors.New("not a placeholder type of the template")
+	// ErrParamName when a type parameter name is already used by a global
+	ErrParamName = errors.New("type parameter name already used")
+)
+
+// Param is a placeholder type of a template which becomes a type parameter
+type Param struct {
+	// Placeholder is the type declared by the template, e.g. Type
+	Placeholder string
+	// Name is the type parameter, e.g. T
+	Name string
+}
+
+// Problem is a construct of the template which can't be expressed with generics
+type Problem struct {
+	Node dst.Node
+	Msg  string
+}
+
+// Convert turns the placeholder types of params into type parameters of every declaration
+// using them, directly or through other declarations. References to those declarations
+// are instantiated with the type parameters, e.g. Set becomes Set[T], and the placeholders are removed.
+//
+// Constraints are taken from //gg:constraint directives, or else from the methods of a placeholder
+// interface and what is required by how its values are used, e.g. comparable for map keys, cmp.Ordered for <.
+// Constructs which can't be expressed with generics are returned as problems, df is converted anyway.
+func Convert(df *dst.File, params []Param) (problems []Problem, err error) {
+	directives := check.ConstraintsOf(df)
+	c, err := typeCheck(df)
+	if err != nil {
+		return
+	}
+	if err = c.setPlaceholders(params, directives); err != nil {
+		return
+	}
+
+	units := globals.Units(df)
+	owner := make(map[string]*globals.Unit)
+	for _, u := range units {
+		for _, name := range u.Names {
+			owner[name] = u
+		}
+	}
+	byPlaceholder := make(map[string]Param)
+	for _, p := range params {
+		byPlaceholder[p.Placeholder] = p
+	}
+	for _, p := range params {
+		if _, ok := byPlaceholder[p.Name]; owner[p.Name] != nil && !ok {
+			err = fmt.Errorf("%v: %s", ErrParamName, p.Name)
+			return
+		}
+	}
+
+	// type parameters of each unit, in the order of params
+	paramsOf := make(map[*globals.Unit][]Param)
+	for _, p := range params {
+		for u := range globals.Dependents(units, map[string]bool{p.Placeholder: true}) {
+			paramsOf[u] = append(paramsOf[u], p)
+		}
+	}
+	var (
+		specs   = make(map[string]*dst.TypeSpec) // of the placeholders, to be removed
+		declIDs = make(map[*dst.Ident]bool)
+		generic = make(map[string][]Param) // generic types and funcs
+	)
+	for _, u := range units {
+		if s, ok := u.Node.(*dst.TypeSpec); ok {
+			if _, ok := byPlaceholder[s.Name.Name]; ok {
+				specs[s.Name.Name] = s
+				delete(paramsOf, u)
+				continue
+			}
+			declIDs[s.Name] = true
+		}
+		if fd, ok := u.Node.(*dst.FuncDecl); ok {
+			declIDs[fd.Name] = true
+		}
+		ps := paramsOf[u]
+		if len(ps) == 0 {
+			continue
+		}
+		switch {
+		case u.Kind == globals.KindVar || u.Kind == globals.KindConst:
+			problems = append(problems, Problem{Node: u.Node, Msg: fmt.Sprintf("package level %s %s depends on %s, it can't have type parameters", u.Kind, u.Names[0], ps[0].Placeholder)})
+		case u.Recv != "":
+			if _, ok := byPlaceholder[u.Recv]; ok {
+				problems = append(problems, Problem{Node: u.Node, Msg: fmt.Sprintf("method %s of %s, a type parameter can't have methods", u.Node.(*dst.FuncDecl).Name.Name, u.Recv)})
+			}
+		default:
+			for _, name := range u.Names {
+				generic[name] = ps
+			}
+		}
+	}
+	problems = append(problems, c.problems(params)...)
+
+	// nil values become zero values, while nil comparisons are left as they are
+	var names []string
+	for _, p := range params {
+		names = append(names, p.Placeholder)
+	}
+	zeros := make(map[*dst.Ident]dst.Expr)
+	for _, use := range globals.FindNil(df, names) {
+		if use.Cmp != nil {
+			problems = append(problems, Problem{Node: use.Cmp, Msg: fmt.Sprintf("%s compared with nil, a type parameter can't be", use.TypeName)})
+			continue
+		}
+		zeros[use.Nil] = globals.ZeroValue(use.TypeName, "")
+	}
+	globals.ReplaceNil(df, zeros)
+
+	// placeholders become the type parameters, uses of generic declarations are instantiated
+	uses := make(map[*dst.Ident][]Param)
+	globals.RenameDecl(df, func(id *dst.Ident, kind globals.SymKind) {
+		if p, ok := byPlaceholder[id.Name]; ok && kind == globals.KindType {
+			id.Name = p.Name
+			return
+		}
+		if ps := generic[id.Name]; len(ps) > 0 && !declIDs[id] && (kind == globals.KindType || kind == globals.KindFunc) {
+			uses[id] = ps
+		}
+	})
+	dstutil.Apply(df, nil, func(cur *dstutil.Cursor) bool {
+		if id, ok := cur.Node().(*dst.Ident); ok && uses[id] != nil {
+			var indices []dst.Expr
+			for _, p := range uses[id] {
+				indices = append(indices, dst.NewIdent(p.Name))
+			}
+			cur.Replace(instantiated(id, indices))
+		}
+		return true
+	})
+
+	constraints := make(map[string]dst.Expr)
+	for _, p := range params {
+		var cproblems []Problem
+		constraints[p.Placeholder], cproblems = c.constraint(p, specs[p.Placeholder], directives[p.Placeholder])
+		problems = append(problems, cproblems...)
+	}
+	for _, u := range units {
+		ps := paramsOf[u]
+		if len(ps) == 0 || u.Kind == globals.KindVar || u.Kind == globals.KindConst {
+			continue
+		}
+		list := &dst.FieldList{}
+		for _, p := range ps {
+			list.List = append(list.List, &dst.Field{Names: []*dst.Ident{dst.NewIdent(p.Name)}, Type: dst.Clone(constraints[p.Placeholder]).(dst.Expr)})
+		}
+		switch x := u.Node.(type) {
+		case *dst.TypeSpec:
+			x.TypeParams = list
+		case *dst.FuncDecl:
+			// methods have the type parameters of their receivers
+			if x.Recv == nil {
+				x.Type.TypeParams = list
+			}
+		}
+	}
+
+	removeSpecs(df, specs)
+	for _, e := range constraints {
+		if usesCmp(e) {
+			if _, ok := globals.GetImportMapDst(df)["cmp"]; !ok {
+				globals.AddImports(df, map[string]string{"cmp": "cmp"})
+			}
+			break
+		}
+	}
+	return
+}
+
+// checked is a template with its type information
+type checked struct {
+	files        []*ast.File
+	pkg          *types.Package
+	info         *types.Info
+	placeholders map[types.Type]string
+	levels       map[string]level
+	dstNode      func(ast.Node) dst.Node
+}
+
+// typeCheck type checks df, errors are ignored so that a template is converted as far as it's understood
+func typeCheck(df *dst.File) (c *checked, err error) {
+	r := decorator.NewRestorer()
+	f, err := r.RestoreFile(df)
+	if err != nil {
+		return
+	}
+
+	c = &checked{
+		files: []*ast.File{f},
+		info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			Instances:  make(map[*ast.Ident]types.Instance),
+		},
+		placeholders: make(map[types.Type]string),
+		dstNode:      func(n ast.Node) dst.Node { return r.Dst.Nodes[n] },
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(r.Fset, "source", nil),
+		Error:    func(error) {},
+	}
+	c.pkg, _ = conf.Check(df.Name.Name, r.Fset, c.files, c.info)
+	return
+}
+
+// setPlaceholders finds the types of the placeholders and what is required of them
+func (c *checked) setPlaceholders(params []Param, directives map[string][]string) (err error) {
+	for _, p := range params {
+		tn, ok := c.pkg.Scope().Lookup(p.Placeholder).(*types.TypeName)
+		if !ok {
+			err = fmt.Errorf("%v: %s", ErrPlaceholder, p.Placeholder)
+			return
+		}
+		c.placeholders[tn.Type()] = p.Placeholder
+	}
+	c.levels = inferLevels(c.files, c.info, c.placeholders)
+	for _, p := range params {
+		// declared constraints are what the type parameter gets
+		if ds := directives[p.Placeholder]; len(ds) > 0 {
+			c.levels[p.Placeholder] = levelAny
+			for _, d := range ds {
+				if l := directiveLevel(d); l > c.levels[p.Placeholder] {
+					c.levels[p.Placeholder] = l
+				}
+			}
+		}
+	}
+	return
+}
+
+// placeholderOf returns the placeholder e is a value of, or a pointer to a value of
+func (c *checked) placeholderOf(e ast.Expr) string {
+	return c.placeholders[deref(c.info.TypeOf(e))]
+}
+
+// problems finds uses of the placeholders which can't be expressed with type parameters
+func (c *checked) problems(params []Param) (problems []Problem) {
+	names := make(map[string]string)
+	for _, p := range params {
+		names[p.Name] = p.Placeholder
+	}
+	report := func(n ast.Node, format string, args ...interface{}) {
+		problems = append(problems, Problem{Node: c.dstNode(n), Msg: fmt.Sprintf(format, args...)})
+	}
+	embedded := func(l *ast.FieldList) {
+		for _, f := range l.List {
+			if len(f.Names) == 0 {
+				if name := c.placeholderOf(f.Type); name != "" {
+					report(f, "%s is embedded, a type parameter can't be embedded", name)
+				}
+			}
+		}
+	}
+
+	for _, f := range c.files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.GenDecl:
+				// reported as a whole
+				return x.Tok != token.CONST
+			case *ast.StructType:
+				embedded(x.Fields)
+			case *ast.InterfaceType:
+				embedded(x.Methods)
+			case *ast.SelectorExpr:
+				if sel := c.info.Selections[x]; sel != nil && sel.Kind() == types.FieldVal {
+					if name := c.placeholders[deref(sel.Recv())]; name != "" {
+						report(x, "field %s of %s, fields of a type parameter can't be accessed", x.Sel.Name, name)
+					}
+				}
+			case *ast.CompositeLit:
+				if name := c.placeholders[c.info.TypeOf(x)]; name != "" {
+					report(x, "composite literal of %s, a type parameter has no core type to construct", name)
+					return false
+				}
+			case *ast.CallExpr:
+				if tv := c.info.Types[x.Fun]; tv.IsType() && len(x.Args) == 1 {
+					if name := c.placeholders[tv.Type]; name != "" && !c.convertible(x.Args[0], name) {
+						report(x, "conversion to %s, not all types satisfying the constraint can be converted to", name)
+						return false
+					}
+				}
+			case *ast.Ident:
+				if obj := c.info.Defs[x]; obj != nil && obj.Parent() != nil && obj.Parent() != c.pkg.Scope() {
+					if placeholder, ok := names[x.Name]; ok {
+						report(x, "%s shadows %s, which becomes the type parameter %s", x.Name, placeholder, x.Name)
+					}
+				}
+			case ast.Expr:
+				if tv := c.info.Types[x]; tv.Value != nil {
+					if name := c.placeholders[tv.Type]; name != "" && !c.constantOK(tv.Value, name) {
+						report(x, "constant %s of %s, not all types satisfying the constraint can represent it", tv.Value, name)
+						return false
+					}
+				}
+			}
+			return true
+		})
+	}
+	return
+}
+
+// convertible tells whether e can be converted to the type parameter of placeholder
+func (c *checked) convertible(e ast.Expr, placeholder string) bool {
+	tv := c.info.Types[e]
+	if c.placeholders[tv.Type] == placeholder {
+		return true
+	}
+	if tv.Value != nil {
+		return c.constantOK(tv.Value, placeholder)
+	}
+	b, ok := tv.Type.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsNumeric != 0 && c.levels[placeholder] >= levelNumeric
+}
+
+// constantOK tells whether v is representable by all numeric types, which is what the inferred constraint
+// is at most, e.g. 1 is but -1 or 300 is not
+func (c *checked) constantOK(v constant.Value, placeholder string) bool {
+	if c.levels[placeholder] < levelNumeric {
+		return false
+	}
+	i, ok := constant.Int64Val(constant.ToInt(v))
+	return ok && i >= 0 && i <= 127
+}
+
+// constraint returns the constraint of the type parameter of p, spec is the placeholder declaration
+func (c *checked) constraint(p Param, spec *dst.TypeSpec, directives []string) (e dst.Expr, problems []Problem) {
+	var fields []*dst.Field
+	if len(directives) > 0 {
+		for _, d := range directives {
+			de, ok := directiveConstraint(d)
+			if !ok {
+				problems = append(problems, Problem{Node: spec, Msg: fmt.Sprintf("constraint %q of %s can't be expressed with generics", d, p.Placeholder)})
+				continue
+			}
+			fields = append(fields, &dst.Field{Type: de})
+		}
+	} else {
+		if l := c.levels[p.Placeholder]; l > levelAny {
+			fields = append(fields, &dst.Field{Type: levelConstraint(l)})
+		}
+		// the methods required of the placeholder interface
+		if it, ok := spec.Type.(*dst.InterfaceType); ok {
+			for _, m := range it.Methods.List {
+				fields = append(fields, dst.Clone(m).(*dst.Field))
+			}
+		}
+	}
+
+	switch {
+	case len(fields) == 0:
+		e = dst.NewIdent("any")
+	case len(fields) == 1 && len(fields[0].Names) == 0:
+		e = fields[0].Type
+	default:
+		for _, f := range fields {
+			f.Decs.Before = dst.NewLine
+			f.Decs.After = dst.NewLine
+		}
+		e = &dst.InterfaceType{Methods: &dst.FieldList{List: fields}}
+	}
+	return
+}
+
+// instantiated returns id instantiated with the type arguments indices, e.g. Set[T]
+func instantiated(id *dst.Ident, indices []dst.Expr) dst.Expr {
+	decs := id.Decs.NodeDecs
+	id.Decs.NodeDecs = dst.NodeDecs{}
+	if len(indices) == 1 {
+		ie := &dst.IndexExpr{X: id, Index: indices[0]}
+		ie.Decs.NodeDecs = decs
+		return ie
+	}
+	ile := &dst.IndexListExpr{X: id, Indices: indices}
+	ile.Decs.NodeDecs = decs
+	return ile
+}
+
+// removeSpecs removes the placeholder declarations
+func removeSpecs(df *dst.File, specs map[string]*dst.TypeSpec) {
+	remove := make(map[dst.Spec]bool)
+	for _, s := range specs {
+		remove[s] = true
+	}
+	var decls []dst.Decl
+	for _, d := range df.Decls {
+		if gd, ok := d.(*dst.GenDecl); ok && gd.Tok == token.TYPE {
+			var kept []dst.Spec
+			for _, s := range gd.Specs {
+				if !remove[s] {
+					kept = append(kept, s)
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			if len(kept) < len(gd.Specs) && len(kept) == 1 {
+				gd.Lparen = false
+			}
+			gd.Specs = kept
+		}
+		decls = append(decls, d)
+	}
+	df.Decls = decls
+}
+
+// usesCmp tells whether e refers to package cmp
+func usesCmp(e dst.Expr) (found bool) {
+	dst.Inspect(e, func(n dst.Node) bool {
+		if sel, ok := n.(*dst.SelectorExpr); ok {
+			if id, ok := sel.X.(*dst.Ident); ok && id.Name == "cmp" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return
+}
+
+func deref(t types.Type) types.Type {
+	if p, ok := t.(*types.Pointer); ok {
+		return p.Elem()
+	}
+	return t
+}
@@ -0,0 +1,567 @@
+package generic
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/dstutil"
+
+	"github.com/zhiqiangxu/gg/pkg/globals"
+)
+
+var (
+	// ErrTypeArgs when type arguments don't match the type parameters of generic declarations
+	ErrTypeArgs = errors.New("invalid type arguments")
+)
+
+// maxInstances bounds the instantiations of a file, which are infinite for recursive ones like List[List[T]]
+const maxInstances = 1000
+
+// genericDecl is a generic type with its methods, or a generic function
+type genericDecl struct {
+	name    string
+	params  []string
+	spec    *dst.TypeSpec
+	fn      *dst.FuncDecl
+	methods []*dst.FuncDecl
+	insts   []*instance
+}
+
+// instance is a generic declaration instantiated with type arguments
+type instance struct {
+	decl *genericDecl
+	args []string
+	name string
+	// copies of the declaration and methods with the type arguments substituted
+	spec    *dst.TypeSpec
+	fn      *dst.FuncDecl
+	methods []*dst.FuncDecl
+}
+
+// IsGeneric tells whether df declares generic types or functions
+func IsGeneric(df *dst.File) bool {
+	return len(genericDecls(df)) > 0
+}
+
+// TypeParams returns the type parameters of the generic declarations of df,
+// both qualified like List.T and unqualified like T
+func TypeParams(df *dst.File) map[string]bool {
+	params := make(map[string]bool)
+	for _, g := range genericDecls(df) {
+		for _, p := range g.params {
+			params[g.name+"."+p] = true
+			params[p] = true
+		}
+	}
+	return params
+}
+
+// Monomorphize makes the generic declarations of df concrete with the type arguments args, keyed by
+// Decl.Param, or by Param for all declarations having it. Declarations instantiated by those,
+// or by non-generic code, are made concrete too.
+//
+// Each instantiation is a copy of the declaration with the type parameters substituted, named
+// after the declaration, or with the type arguments appended if there are more than one, e.g. ListInt
+// and ListString. Instantiation expressions like List[int] are rewritten to refer to the copy.
+func Monomorphize(df *dst.File, args map[string]string) (err error) {
+	if err = explicitInstances(df); err != nil {
+		return
+	}
+	decls := genericDecls(df)
+
+	// type arguments of the generic declarations
+	bound := make(map[string]map[string]string)
+	qualified := make(map[string]bool)
+	for key, arg := range args {
+		if arg, err = canonical(arg); err != nil {
+			return
+		}
+		name, param := "", key
+		if i := strings.Index(key, "."); i != -1 {
+			name, param = key[:i], key[i+1:]
+		}
+		found := false
+		for _, g := range decls {
+			if (name == "" || g.name == name) && g.hasParam(param) {
+				if bound[g.name] == nil {
+					bound[g.name] = make(map[string]string)
+				}
+				// qualified ones take precedence
+				if _, ok := bound[g.name][param]; !ok || name != "" {
+					bound[g.name][param] = arg
+				}
+				qualified[g.name] = qualified[g.name] || name != ""
+				found = true
+			}
+		}
+		if !found {
+			err = fmt.Errorf("%v: no type parameter %s", ErrTypeArgs, key)
+			return
+		}
+	}
+
+	byName := make(map[string]*genericDecl)
+	for _, g := range decls {
+		byName[g.name] = g
+	}
+	var (
+		insts   = make(map[string]*instance)
+		pending []*instance
+	)
+	instantiate := func(g *genericDecl, args []string) *instance {
+		key := g.name + "[" + strings.Join(args, ", ") + "]"
+		if inst := insts[key]; inst != nil {
+			return inst
+		}
+		inst := &instance{decl: g, args: args}
+		insts[key] = inst
+		g.insts = append(g.insts, inst)
+		pending = append(pending, inst)
+		return inst
+	}
+	// instantiations found in n
+	scan := func(n dst.Node) {
+		dst.Inspect(n, func(n dst.Node) bool {
+			if x, indices := indexed(n); x != nil {
+				if g := byName[x.Name]; g != nil && len(indices) == len(g.params) {
+					var args []string
+					for _, index := range indices {
+						args = append(args, exprString(index))
+					}
+					instantiate(g, args)
+				}
+			}
+			return true
+		})
+	}
+
+	for _, g := range decls {
+		if len(bound[g.name]) == 0 {
+			continue
+		}
+		var args []string
+		for _, p := range g.params {
+			arg, ok := bound[g.name][p]
+			if !ok {
+				break
+			}
+			args = append(args, arg)
+		}
+		if len(args) == len(g.params) {
+			instantiate(g, args)
+		} else if qualified[g.name] {
+			// otherwise it may still be instantiated by others
+			err = fmt.Errorf("%v: no type argument for %s.%s", ErrTypeArgs, g.name, g.params[len(args)])
+			return
+		}
+	}
+	for _, d := range df.Decls {
+		if !isGenericDecl(d) {
+			scan(d)
+		}
+	}
+	for count := 0; len(pending) > 0; count++ {
+		if count == maxInstances {
+			err = fmt.Errorf("%v: more than %d instantiations, which may be recursive", ErrTypeArgs, maxInstances)
+			return
+		}
+		inst := pending[0]
+		pending = pending[1:]
+		if err = inst.substitute(); err != nil {
+			return
+		}
+		if inst.spec != nil {
+			scan(inst.spec)
+		}
+		if inst.fn != nil {
+			scan(inst.fn)
+		}
+		for _, m := range inst.methods {
+			scan(m)
+		}
+	}
+
+	var unused []string
+	for _, g := range decls {
+		if len(g.insts) == 0 {
+			unused = append(unused, g.name)
+		}
+		for _, inst := range g.insts {
+			inst.name = g.name
+			if len(g.insts) > 1 {
+				for _, arg := range inst.args {
+					if e, perr := parseExpr(arg); perr == nil {
+						inst.name += upperFirst(word(e))
+					}
+				}
+			}
+		}
+	}
+	if len(unused) > 0 {
+		err = fmt.Errorf("%v: no type arguments for %s, use -t %s.%s=type", ErrTypeArgs, strings.Join(unused, ", "), unused[0], byName[unused[0]].params[0])
+		return
+	}
+
+	replaceDecls(df, decls)
+
+	// instantiations refer to the concrete declarations
+	dstutil.Apply(df, func(c *dstutil.Cursor) bool {
+		x, indices := indexed(c.Node())
+		if x == nil || byName[x.Name] == nil {
+			return true
+		}
+		var args []string
+		for _, index := range indices {
+			args = append(args, exprString(index))
+		}
+		if inst := insts[x.Name+"["+strings.Join(args, ", ")+"]"]; inst != nil {
+			id := dst.NewIdent(inst.name)
+			id.Decs.NodeDecs = *c.Node().Decorations()
+			c.Replace(id)
+		}
+		return true
+	}, nil)
+	return
+}
+
+// genericDecls returns the generic declarations of df in the order they are declared
+func genericDecls(df *dst.File) (decls []*genericDecl) {
+	byName := make(map[string]*genericDecl)
+	for _, d := range df.Decls {
+		switch x := d.(type) {
+		case *dst.GenDecl:
+			if x.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range x.Specs {
+				s := s.(*dst.TypeSpec)
+				if s.TypeParams != nil && len(s.TypeParams.List) > 0 {
+					g := &genericDecl{name: s.Name.Name, params: fieldNames(s.TypeParams), spec: s}
+					byName[g.name] = g
+					decls = append(decls, g)
+				}
+			}
+		case *dst.FuncDecl:
+			if x.Recv == nil && x.Type.TypeParams != nil && len(x.Type.TypeParams.List) > 0 {
+				g := &genericDecl{name: x.Name.Name, params: fieldNames(x.Type.TypeParams), fn: x}
+				byName[g.name] = g
+				decls = append(decls, g)
+			}
+		}
+	}
+	for _, d := range df.Decls {
+		if fd, ok := d.(*dst.FuncDecl); ok && fd.Recv != nil {
+			if g := byName[globals.RecvTypeName(fd)]; g != nil && g.spec != nil {
+				g.methods = append(g.methods, fd)
+			}
+		}
+	}
+	return
+}
+
+func (g *genericDecl) hasParam(param string) bool {
+	for _, p := range g.params {
+		if p == param {
+			return true
+		}
+	}
+	return false
+}
+
+// isGenericDecl tells whether d is a generic function or method, or declares generic types only
+func isGenericDecl(d dst.Decl) bool {
+	switch x := d.(type) {
+	case *dst.GenDecl:
+		if x.Tok != token.TYPE {
+			return false
+		}
+		for _, s := range x.Specs {
+			if s := s.(*dst.TypeSpec); s.TypeParams == nil || len(s.TypeParams.List) == 0 {
+				return false
+			}
+		}
+		return true
+	case *dst.FuncDecl:
+		if x.Recv != nil {
+			_, indices := indexed(recvType(x))
+			return len(indices) > 0
+		}
+		return x.Type.TypeParams != nil && len(x.Type.TypeParams.List) > 0
+	}
+	return false
+}
+
+// substitute makes the copies of the declaration with the type arguments
+func (inst *instance) substitute() (err error) {
+	g := inst.decl
+	switch {
+	case g.spec != nil:
+		inst.spec = dst.Clone(g.spec).(*dst.TypeSpec)
+		inst.spec.TypeParams = nil
+		if err = substituteParams(inst.spec, g.params, inst.args); err != nil {
+			return
+		}
+		for _, m := range g.methods {
+			m = dst.Clone(m).(*dst.FuncDecl)
+			// the receiver may name the type parameters differently
+			var params []string
+			_, indices := indexed(recvType(m))
+			for _, index := range indices {
+				if id, ok := index.(*dst.Ident); ok {
+					params = append(params, id.Name)
+				} else {
+					params = append(params, "")
+				}
+			}
+			if err = substituteParams(m, params, inst.args); err != nil {
+				return
+			}
+			inst.methods = append(inst.methods, m)
+		}
+	case g.fn != nil:
+		inst.fn = dst.Clone(g.fn).(*dst.FuncDecl)
+		inst.fn.Type.TypeParams = nil
+		err = substituteParams(inst.fn, g.params, inst.args)
+	}
+	return
+}
+
+// substituteParams replaces uses of the type parameters params in n with args
+func substituteParams(n dst.Node, params, args []string) (err error) {
+	exprs := make(map[string]dst.Expr)
+	for i, p := range params {
+		if p == "" || p == "_" {
+			continue
+		}
+		if exprs[p], err = parseExpr(args[i]); err != nil {
+			return
+		}
+	}
+	dstutil.Apply(n, func(c *dstutil.Cursor) bool {
+		id, ok := c.Node().(*dst.Ident)
+		if !ok || exprs[id.Name] == nil {
+			return true
+		}
+		// names of fields, methods, labels and such
+		switch c.Parent().(type) {
+		case *dst.SelectorExpr:
+			if c.Name() == "Sel" {
+				return true
+			}
+		case *dst.KeyValueExpr:
+			if c.Name() == "Key" {
+				return true
+			}
+		case *dst.Field, *dst.FuncDecl, *dst.TypeSpec, *dst.ValueSpec, *dst.LabeledStmt, *dst.BranchStmt:
+			if c.Name() != "Type" {
+				return true
+			}
+		}
+		e := dst.Clone(exprs[id.Name]).(dst.Expr)
+		e.Decorations().Before = id.Decs.Before
+		e.Decorations().After = id.Decs.After
+		c.Replace(e)
+		return true
+	}, nil)
+	return
+}
+
+// replaceDecls replaces the generic declarations of df with their instantiations
+func replaceDecls(df *dst.File, decls []*genericDecl) {
+	specs := make(map[*dst.TypeSpec]*genericDecl)
+	fns := make(map[*dst.FuncDecl]*genericDecl)
+	methods := make(map[*dst.FuncDecl]int) // index in the methods of its type
+	for _, g := range decls {
+		if g.spec != nil {
+			specs[g.spec] = g
+		} else {
+			fns[g.fn] = g
+		}
+		for i, m := range g.methods {
+			fns[m] = g
+			methods[m] = i
+		}
+	}
+
+	var result []dst.Decl
+	for _, d := range df.Decls {
+		switch x := d.(type) {
+		case *dst.GenDecl:
+			if x.Tok != token.TYPE {
+				break
+			}
+			if len(x.Specs) == 1 && specs[x.Specs[0].(*dst.TypeSpec)] != nil {
+				// a declaration of its own for each instance
+				g := specs[x.Specs[0].(*dst.TypeSpec)]
+				for _, inst := range g.insts {
+					gd := dst.Clone(x).(*dst.GenDecl)
+					inst.spec.Name.Name = inst.name
+					gd.Specs = []dst.Spec{inst.spec}
+					renameComment(gd, g.name, inst.name)
+					result = append(result, gd)
+				}
+				continue
+			}
+			var list []dst.Spec
+			for _, s := range x.Specs {
+				g := specs[s.(*dst.TypeSpec)]
+				if g == nil {
+					list = append(list, s)
+					continue
+				}
+				for _, inst := range g.insts {
+					inst.spec.Name.Name = inst.name
+					renameComment(inst.spec, g.name, inst.name)
+					list = append(list, inst.spec)
+				}
+			}
+			x.Specs = list
+		case *dst.FuncDecl:
+			g := fns[x]
+			if g == nil {
+				break
+			}
+			for _, inst := range g.insts {
+				if x.Recv == nil {
+					inst.fn.Name.Name = inst.name
+					renameComment(inst.fn, g.name, inst.name)
+					result = append(result, inst.fn)
+				} else {
+					result = append(result, inst.methods[methods[x]])
+				}
+			}
+			continue
+		}
+		result = append(result, d)
+	}
+	df.Decls = result
+}
+
+// renameComment renames the declaration in its doc comment
+func renameComment(n dst.Node, old, name string) {
+	if old == name {
+		return
+	}
+	for i, comment := range n.Decorations().Start {
+		n.Decorations().Start[i] = strings.ReplaceAll(comment, old, name)
+	}
+}
+
+// explicitInstances adds the inferred type arguments to instantiations of generic declarations
+// of df, e.g. Map(s, f) becomes Map[int, string](s, f), so that they can be substituted
+func explicitInstances(df *dst.File) (err error) {
+	c, err := typeCheck(df)
+	if err != nil {
+		return
+	}
+	names := make(map[string]string) // import path -> name
+	for name, path := range globals.GetImportMapDst(df) {
+		names[path] = name
+	}
+	qualifier := func(pkg *types.Package) string {
+		if pkg == c.pkg {
+			return ""
+		}
+		if name, ok := names[pkg.Path()]; ok {
+			return name
+		}
+		return pkg.Name()
+	}
+
+	explicit := make(map[*ast.Ident]bool)
+	for _, f := range c.files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.IndexExpr:
+				if id, ok := x.X.(*ast.Ident); ok {
+					explicit[id] = true
+				}
+			case *ast.IndexListExpr:
+				if id, ok := x.X.(*ast.Ident); ok {
+					explicit[id] = true
+				}
+			}
+			return true
+		})
+	}
+
+	inferred := make(map[*dst.Ident][]dst.Expr)
+	var ids []*ast.Ident
+	for id := range c.info.Instances {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+	for _, id := range ids {
+		obj := c.info.Uses[id]
+		if explicit[id] || obj == nil || obj.Pkg() != c.pkg || obj.Parent() != c.pkg.Scope() {
+			continue
+		}
+		did, ok := c.dstNode(id).(*dst.Ident)
+		if !ok {
+			continue
+		}
+		targs := c.info.Instances[id].TypeArgs
+		for i := 0; i < targs.Len(); i++ {
+			var e dst.Expr
+			if e, err = parseExpr(types.TypeString(targs.At(i), qualifier)); err != nil {
+				return
+			}
+			inferred[did] = append(inferred[did], e)
+		}
+	}
+
+	dstutil.Apply(df, func(c *dstutil.Cursor) bool {
+		id, ok := c.Node().(*dst.Ident)
+		if !ok || inferred[id] == nil {
+			return true
+		}
+		c.Replace(instantiated(dst.Clone(id).(*dst.Ident), inferred[id]))
+		return true
+	}, nil)
+	return
+}
+
+// indexed returns the generic name and type arguments if n is an instantiation like List[int]
+func indexed(n dst.Node) (x *dst.Ident, indices []dst.Expr) {
+	switch e := n.(type) {
+	case *dst.IndexExpr:
+		if id, ok := e.X.(*dst.Ident); ok {
+			return id, []dst.Expr{e.Index}
+		}
+	case *dst.IndexListExpr:
+		if id, ok := e.X.(*dst.Ident); ok {
+			return id, e.Indices
+		}
+	}
+	return nil, nil
+}
+
+// recvType returns the receiver type of a method without pointer and parens
+func recvType(fd *dst.FuncDecl) dst.Expr {
+	e := fd.Recv.List[0].Type
+	for {
+		switch x := e.(type) {
+		case *dst.StarExpr:
+			e = x.X
+		case *dst.ParenExpr:
+			e = x.X
+		default:
+			return e
+		}
+	}
+}
+
+func fieldNames(l *dst.FieldList) (names []string) {
+	for _, f := range l.List {
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+	}
+	return
+}
@@ -0,0 +1,210 @@
+package globals
+
+import (
+	"go/token"
+
+	"github.com/dave/dst"
+)
+
+// Unit is a top level declaration, or a spec of a type declaration,
+// which is kept or dropped as a whole
+type Unit struct {
+	// Node is either a *dst.TypeSpec, a *dst.GenDecl of var or const, or a *dst.FuncDecl
+	Node dst.Node
+	// Names are the globals declared, empty for methods
+	Names []string
+	// Kind of the globals declared, KindFunc for methods
+	Kind SymKind
+	// Recv is the receiver type name for methods
+	Recv string
+	// Refs are the globals referred to, including those declared
+	Refs map[string]bool
+}
+
+// Units returns the units of df with the globals they refer to, imports are excluded
+func Units(df *dst.File) (units []*Unit) {
+	var cur *Unit
+	v := walker{
+		df: df,
+		f: func(ident *dst.Ident, kind SymKind) {
+			if cur != nil && kind != KindImport {
+				cur.Refs[ident.Name] = true
+			}
+		},
+		unitf: func(n dst.Node) {
+			cur = &Unit{Node: n, Refs: make(map[string]bool)}
+			switch x := n.(type) {
+			case *dst.TypeSpec:
+				cur.Names = []string{x.Name.Name}
+				cur.Kind = KindType
+			case *dst.GenDecl:
+				if x.Tok == token.IMPORT {
+					cur = nil
+					return
+				}
+				cur.Kind = KindVar
+				if x.Tok == token.CONST {
+					cur.Kind = KindConst
+				}
+				for _, s := range x.Specs {
+					for _, name := range s.(*dst.ValueSpec).Names {
+						cur.Names = append(cur.Names, name.Name)
+					}
+				}
+			case *dst.FuncDecl:
+				cur.Kind = KindFunc
+				if x.Recv == nil {
+					cur.Names = []string{x.Name.Name}
+				} else {
+					cur.Recv = RecvTypeName(x)
+				}
+			}
+			units = append(units, cur)
+		},
+	}
+
+	v.walk()
+	return
+}
+
+// Dependents returns the units depending on any of the globals in seeds, directly or through other units.
+// A method depends on what its receiver type depends on and vice versa, since they go together.
+func Dependents(units []*Unit, seeds map[string]bool) (dependents map[*Unit]bool) {
+	owner := make(map[string]*Unit)
+	for _, u := range units {
+		for _, name := range u.Names {
+			owner[name] = u
+		}
+	}
+	// group is the unit a unit goes with, i.e., the receiver type for methods
+	group := func(u *Unit) *Unit {
+		if o := owner[u.Recv]; u.Recv != "" && o != nil {
+			return o
+		}
+		return u
+	}
+
+	dependents = make(map[*Unit]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, u := range units {
+			g := group(u)
+			if dependents[g] {
+				continue
+			}
+			for ref := range u.Refs {
+				if seeds[ref] || (owner[ref] != nil && owner[ref] != g && dependents[owner[ref]]) {
+					dependents[g] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	// methods follow their receiver types
+	for _, u := range units {
+		if g := group(u); g != u && dependents[g] {
+			dependents[u] = true
+		}
+	}
+	return
+}
+
+// Reachable returns the units reachable from the globals in roots through what they refer to.
+// A type reaches its methods, so methods of kept types are kept along with what their bodies refer to.
+// Units for which optional returns true, e.g. `var _ I = T{}` or tests, are not reached by others
+// but kept if all globals they refer to are kept.
+func Reachable(units []*Unit, roots map[string]bool, optional func(*Unit) bool) (reached map[*Unit]bool) {
+	owners := make(map[string][]*Unit)
+	methods := make(map[string][]*Unit)
+	for _, u := range units {
+		if optional(u) {
+			continue
+		}
+		for _, name := range u.Names {
+			owners[name] = append(owners[name], u)
+		}
+		if u.Recv != "" {
+			methods[u.Recv] = append(methods[u.Recv], u)
+		}
+	}
+
+	reached = make(map[*Unit]bool)
+	var queue []*Unit
+	reach := func(us []*Unit) {
+		for _, u := range us {
+			if !reached[u] {
+				reached[u] = true
+				queue = append(queue, u)
+			}
+		}
+	}
+	for name := range roots {
+		reach(owners[name])
+	}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, name := range u.Names {
+			reach(methods[name])
+		}
+		for ref := range u.Refs {
+			reach(owners[ref])
+		}
+	}
+
+	// optional units are dropped until all they refer to is kept, including other optional units
+	declared := make(map[string]bool)
+	for _, u := range units {
+		for _, name := range u.Names {
+			declared[name] = true
+		}
+	}
+	kept := make(map[string]bool)
+	for name, us := range owners {
+		for _, u := range us {
+			if reached[u] {
+				kept[name] = true
+			}
+		}
+	}
+	var opts []*Unit
+	for _, u := range units {
+		if optional(u) {
+			opts = append(opts, u)
+			reached[u] = true
+			for _, name := range u.Names {
+				kept[name] = true
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, u := range opts {
+			if !reached[u] {
+				continue
+			}
+			for ref := range u.Refs {
+				if declared[ref] && !kept[ref] && !declares(u, ref) {
+					reached[u] = false
+					for _, name := range u.Names {
+						kept[name] = false
+					}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+func declares(u *Unit, name string) bool {
+	for _, n := range u.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
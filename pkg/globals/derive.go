@@ -0,0 +1,280 @@
+package globals
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dave/dst"
+)
+
+// DeriveNames finds global identifiers and methods which contain the name of a replaced type
+// as a camel-case word, and derives new names for them, e.g. with Something=string,
+// SomethingQueue becomes StringQueue and somethingNode becomes stringNode.
+// Methods, including those of interfaces, are keyed like SomethingQueue.PushSomething as
+// expected by RenameMembers.
+//
+// Names already present in declares are left alone.
+func DeriveNames(df *dst.File, typeMap map[string]string, declares map[string]string) (globalMap, methodMap map[string]string, err error) {
+	globalMap = make(map[string]string)
+	methodMap = make(map[string]string)
+
+	words := make(map[string]string)
+	for old, target := range typeMap {
+		if word := TypeWord(target); word != "" {
+			words[old] = word
+		}
+	}
+	if len(words) == 0 {
+		return
+	}
+
+	// longer names first, so that KeyValue wins over Key in KeyValueMap
+	olds := make([]string, 0, len(words))
+	for old := range words {
+		olds = append(olds, old)
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+	derive := func(name string) string {
+		return replaceWords(name, olds, words)
+	}
+
+	// globals
+	existing := make(map[string]bool)
+	WalkGlobalsDst(df, func(name string, kind SymKind) bool {
+		if kind == KindImport {
+			return true
+		}
+		existing[name] = true
+		if _, ok := typeMap[name]; ok {
+			return true
+		}
+		if _, ok := declares[name]; ok {
+			return true
+		}
+		if newName := derive(name); newName != name {
+			globalMap[name] = newName
+		}
+		return true
+	})
+
+	// methods, grouped by receiver type for collision check
+	recvMethods := make(map[string]map[string]bool)
+	addMethod := func(recv, name string) {
+		if recvMethods[recv] == nil {
+			recvMethods[recv] = make(map[string]bool)
+		}
+		recvMethods[recv][name] = true
+		if newName := derive(name); newName != name {
+			methodMap[recv+"."+name] = newName
+		}
+	}
+	for _, d := range df.Decls {
+		switch x := d.(type) {
+		case *dst.FuncDecl:
+			if x.Recv != nil {
+				addMethod(RecvTypeName(x), x.Name.Name)
+			}
+		case *dst.GenDecl:
+			for _, spec := range x.Specs {
+				ts, ok := spec.(*dst.TypeSpec)
+				if !ok {
+					continue
+				}
+				it, ok := ts.Type.(*dst.InterfaceType)
+				if !ok || it.Methods == nil {
+					continue
+				}
+				for _, f := range it.Methods.List {
+					for _, name := range f.Names {
+						addMethod(ts.Name.Name, name.Name)
+					}
+				}
+			}
+		}
+	}
+
+	// collision check
+	var collisions []string
+	final := make(map[string]string)
+	for old, newName := range declares {
+		final[newName] = old
+	}
+	for old, newName := range globalMap {
+		if prev, ok := final[newName]; ok {
+			collisions = append(collisions, fmt.Sprintf("%s and %s both renamed to %s", prev, old, newName))
+			continue
+		}
+		final[newName] = old
+		if existing[newName] && globalMap[newName] == "" && declares[newName] == "" {
+			collisions = append(collisions, fmt.Sprintf("%s renamed to existing %s", old, newName))
+		}
+		if token.Lookup(newName).IsKeyword() || types.Universe.Lookup(newName) != nil {
+			collisions = append(collisions, fmt.Sprintf("%s renamed to predeclared %s", old, newName))
+		}
+	}
+	for recv, methods := range recvMethods {
+		for old := range methods {
+			newName, ok := methodMap[recv+"."+old]
+			if !ok {
+				continue
+			}
+			if methods[newName] && methodMap[recv+"."+newName] == "" {
+				collisions = append(collisions, fmt.Sprintf("method %s renamed to existing %s", old, newName))
+			}
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		err = fmt.Errorf("derived name collision: %s", strings.Join(collisions, "; "))
+	}
+
+	return
+}
+
+// TypeWord returns the word that stands for the type expression target in derived names,
+// for qualified types like pkg.Type only the type part is used.
+// It returns empty string if the expression has no such word.
+func TypeWord(target string) string {
+	expr, err := parser.ParseExpr(target)
+	if err != nil {
+		return ""
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	default:
+		return ""
+	}
+}
+
+// RecvTypeName returns the base type name of the receiver of a method
+func RecvTypeName(fd *dst.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return ""
+	}
+	if id := GetIdentDst(genericBase(recvBase(fd.Recv.List[0].Type))); id != nil {
+		return id.Name
+	}
+	return ""
+}
+
+// recvBase strips the pointer and parens from a receiver type
+func recvBase(e dst.Expr) dst.Expr {
+	for {
+		switch x := e.(type) {
+		case *dst.StarExpr:
+			e = x.X
+		case *dst.ParenExpr:
+			e = x.X
+		default:
+			return e
+		}
+	}
+}
+
+// genericBase returns the generic type or function of an instantiation like List[T], e itself otherwise
+func genericBase(e dst.Expr) dst.Expr {
+	switch x := e.(type) {
+	case *dst.IndexExpr:
+		return x.X
+	case *dst.IndexListExpr:
+		return x.X
+	}
+	return e
+}
+
+// replaceWords replaces every camel-case word of olds in name with its word in one pass,
+// at each position the first of olds matching is replaced, replacements are not matched again
+func replaceWords(name string, olds []string, words map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		old, replacement := matchWord(name, i, olds, words)
+		if replacement != "" {
+			b.WriteString(replacement)
+			i += len(old)
+			continue
+		}
+		b.WriteByte(name[i])
+		i++
+	}
+	return b.String()
+}
+
+// matchWord returns the first of olds found as a camel-case word at i of name, along with its replacement
+func matchWord(name string, i int, olds []string, words map[string]string) (old, replacement string) {
+	for _, old = range olds {
+		word := words[old]
+		if old == "" || word == "" {
+			continue
+		}
+		oldUpper, oldLower := upperFirst(old), lowerFirst(old)
+		switch {
+		case i == 0 && oldLower != oldUpper && strings.HasPrefix(name, oldLower):
+			replacement = lowerFirst(word)
+		case strings.HasPrefix(name[i:], oldUpper) && (i == 0 || isWordStart(name, i, old)):
+			replacement = upperFirst(word)
+		default:
+			continue
+		}
+		if isWordEnd(name, i+len(old)) {
+			return
+		}
+	}
+	return "", ""
+}
+
+// isWordStart reports whether an upper case letter at i starts a word,
+// within an upper case run like XMLSomething only words like Something qualify
+func isWordStart(name string, i int, old string) bool {
+	prev := rune(name[i-1])
+	if !unicode.IsUpper(prev) {
+		return true
+	}
+	return len(old) > 1 && unicode.IsLower(rune(old[1]))
+}
+
+func isWordEnd(name string, i int) bool {
+	if i >= len(name) {
+		return true
+	}
+	next := rune(name[i])
+	return unicode.IsUpper(next) || unicode.IsDigit(next) || next == '_'
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// lowerFirst lowers the leading upper case run, so that URLPath becomes urlPath
+func lowerFirst(s string) string {
+	n := 0
+	for n < len(s) && unicode.IsUpper(rune(s[n])) {
+		n++
+	}
+	switch {
+	case n == 0:
+		return s
+	case n == 1 || n == len(s):
+		return strings.ToLower(s[:n]) + s[n:]
+	case unicode.IsLower(rune(s[n])):
+		return strings.ToLower(s[:n-1]) + s[n-1:]
+	default:
+		return strings.ToLower(s[:n]) + s[n:]
+	}
+}
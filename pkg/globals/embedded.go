@@ -0,0 +1,174 @@
+package globals
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+
+	"github.com/dave/dst"
+)
+
+// Embedded is an embedded field of a struct in a file, along with the selectors and keys of
+// composite literals using its implicit name, which is the name of the embedded type
+type Embedded struct {
+	Field  *dst.Field
+	name   string
+	fields *dst.FieldList
+	uses   []*dst.Ident
+}
+
+// EmbeddedFields returns the embedded fields of structs in df whose types are declared in df,
+// so that their uses can be updated by Update once the types are renamed or replaced.
+// Only uses resolved by type checking df are tracked.
+func EmbeddedFields(df *dst.File) (embeds []*Embedded, err error) {
+	r, f, info, _, err := typeCheck(df)
+	if err != nil {
+		return
+	}
+
+	byIdent := make(map[*ast.Ident]*Embedded)
+	ast.Inspect(f, func(n ast.Node) bool {
+		st, ok := n.(*ast.StructType)
+		if !ok || st.Fields == nil {
+			return true
+		}
+		for _, field := range st.Fields.List {
+			if len(field.Names) > 0 {
+				continue
+			}
+			t := field.Type
+			if se, ok := t.(*ast.StarExpr); ok {
+				t = se.X
+			}
+			switch x := t.(type) {
+			case *ast.IndexExpr:
+				t = x.X
+			case *ast.IndexListExpr:
+				t = x.X
+			}
+			id, ok := t.(*ast.Ident)
+			if !ok {
+				// qualified types are not declared in df
+				continue
+			}
+			e := &Embedded{
+				Field:  r.Dst.Nodes[field].(*dst.Field),
+				name:   id.Name,
+				fields: r.Dst.Nodes[st.Fields].(*dst.FieldList),
+			}
+			byIdent[id] = e
+			embeds = append(embeds, e)
+		}
+		return true
+	})
+
+	byVar := make(map[types.Object]*Embedded)
+	for id, e := range byIdent {
+		if obj := info.Defs[id]; obj != nil {
+			byVar[obj] = e
+		}
+	}
+	for id, obj := range info.Uses {
+		if e, ok := byVar[origin(obj)]; ok {
+			e.uses = append(e.uses, r.Dst.Nodes[id].(*dst.Ident))
+		}
+	}
+	return
+}
+
+// Update renames the uses of the field after its type was renamed or replaced.
+// A replacement which can't be embedded, e.g. []int, or a pointer for a field embedded
+// as a pointer, turns the field into a named one with the original name, so do those
+// whose new names are taken by other fields of the struct.
+func (e *Embedded) Update() {
+	name, ok := embeddedName(e.Field.Type)
+	if name == e.name {
+		return
+	}
+	if ok {
+		for _, f := range e.fields.List {
+			if f == e.Field {
+				continue
+			}
+			for _, other := range fieldNames(f) {
+				if other == name {
+					ok = false
+				}
+			}
+		}
+	}
+	if !ok {
+		e.Field.Names = []*dst.Ident{dst.NewIdent(e.name)}
+		return
+	}
+	for _, id := range e.uses {
+		id.Name = name
+	}
+	e.name = name
+}
+
+// embeddedName returns the implicit name of an embedded field of type t, and whether t can be
+// embedded, i.e., a type name T or a pointer *T to a type name. t may contain identifiers
+// replaced by type expressions like *pkg.Type.
+func embeddedName(t dst.Expr) (name string, ok bool) {
+	s, ok := exprText(t)
+	if !ok {
+		return
+	}
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		return "", false
+	}
+	if se, isStar := expr.(*ast.StarExpr); isStar {
+		expr = se.X
+	}
+	switch x := expr.(type) {
+	case *ast.IndexExpr:
+		expr = x.X
+	case *ast.IndexListExpr:
+		expr = x.X
+	}
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x.Name, true
+	case *ast.SelectorExpr:
+		if _, ok := x.X.(*ast.Ident); ok {
+			return x.Sel.Name, true
+		}
+	}
+	return "", false
+}
+
+// exprText returns the source of the type of an embedded field
+func exprText(t dst.Expr) (string, bool) {
+	switch x := t.(type) {
+	case *dst.Ident:
+		return x.Name, true
+	case *dst.StarExpr:
+		s, ok := exprText(x.X)
+		return "*" + s, ok
+	case *dst.SelectorExpr:
+		s, ok := exprText(x.X)
+		return s + "." + x.Sel.Name, ok
+	case *dst.IndexExpr:
+		s, ok := exprText(x.X)
+		return s + "[_]", ok
+	case *dst.IndexListExpr:
+		s, ok := exprText(x.X)
+		return s + "[_]", ok
+	}
+	return "", false
+}
+
+// fieldNames returns the names of a field, the implicit one for an embedded field
+func fieldNames(f *dst.Field) (names []string) {
+	for _, name := range f.Names {
+		names = append(names, name.Name)
+	}
+	if len(f.Names) == 0 {
+		if name, ok := embeddedName(f.Type); ok {
+			names = append(names, name)
+		}
+	}
+	return
+}
@@ -0,0 +1,254 @@
+package globals
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+)
+
+// OrganizeImports merges the imports of df into one block placed where the first one was,
+// removes those not referred to and dedupes those of the same path, whose references use
+// the name kept. The block is sorted by path and grouped like goimports does, i.e., standard
+// library packages first and the others after an empty line. Imports whose package names
+// can't be determined are kept. It returns the removed import names.
+func OrganizeImports(df *dst.File) (removed []string) {
+	var (
+		specs []*dst.ImportSpec
+		first = -1
+		decs  dst.GenDeclDecorations
+	)
+	var decls []dst.Decl
+	for _, d := range df.Decls {
+		gd, ok := d.(*dst.GenDecl)
+		if !ok || gd.Tok != token.IMPORT || importsC(gd) {
+			decls = append(decls, d)
+			continue
+		}
+		if first == -1 {
+			first = len(decls)
+			decs = gd.Decs
+		}
+		for _, s := range gd.Specs {
+			specs = append(specs, s.(*dst.ImportSpec))
+		}
+	}
+	if first == -1 {
+		return
+	}
+
+	used := usedImports(df)
+	// the name kept for each path, preferring one that is used and not an alias,
+	// imports whose names are unknown are kept as they are
+	kept := make(map[string]*dst.ImportSpec)
+	for _, s := range specs {
+		name, ok := importName(s)
+		if !ok || name == "_" || name == "." || !used[name] {
+			continue
+		}
+		path := importPath(s)
+		if k := kept[path]; k == nil || aliased(k) && !aliased(s) {
+			kept[path] = s
+		}
+	}
+
+	rename := make(map[string]string)
+	var result []*dst.ImportSpec
+	seen := make(map[string]bool)
+	for _, s := range specs {
+		name, ok := importName(s)
+		path := importPath(s)
+		switch {
+		case !ok:
+		case name == "_" || name == ".":
+			// side effects are kept unless the package is imported anyway
+			if kept[path] != nil || seen[name+" "+path] {
+				continue
+			}
+			seen[name+" "+path] = true
+		case kept[path] == s:
+		case kept[path] != nil:
+			rename[name], _ = importName(kept[path])
+			continue
+		default:
+			removed = append(removed, name)
+			continue
+		}
+		result = append(result, s)
+	}
+	if len(rename) > 0 {
+		renameImports(df, rename)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		si, sj := isStdlib(importPath(result[i])), isStdlib(importPath(result[j]))
+		if si != sj {
+			return si
+		}
+		return importPath(result[i]) < importPath(result[j])
+	})
+	var block []dst.Spec
+	for i, s := range result {
+		s.Decs.Before = dst.NewLine
+		if i > 0 && isStdlib(importPath(result[i-1])) && !isStdlib(importPath(s)) {
+			s.Decs.Before = dst.EmptyLine
+		}
+		s.Decs.After = dst.NewLine
+		block = append(block, s)
+	}
+
+	if len(block) > 0 {
+		gd := &dst.GenDecl{Tok: token.IMPORT, Specs: block, Lparen: true, Decs: decs}
+		decls = append(decls[:first], append([]dst.Decl{gd}, decls[first:]...)...)
+	}
+	df.Decls = decls
+	return
+}
+
+// usedImports returns the names referred to as packages, i.e., X of selectors X.Sel,
+// including those of identifiers replaced by type expressions like *pkg.Type
+func usedImports(df *dst.File) map[string]bool {
+	used := make(map[string]bool)
+	for _, d := range df.Decls {
+		if gd, ok := d.(*dst.GenDecl); ok && gd.Tok == token.IMPORT {
+			continue
+		}
+		dst.Inspect(d, func(n dst.Node) bool {
+			switch x := n.(type) {
+			case *dst.SelectorExpr:
+				if id, ok := x.X.(*dst.Ident); ok {
+					used[id.Name] = true
+				}
+			case *dst.Ident:
+				if strings.Contains(x.Name, ".") {
+					for name := range qualifiers(x.Name) {
+						used[name] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+	return used
+}
+
+// qualifiers returns the package names qualifying types in the expression s
+func qualifiers(s string) map[string]bool {
+	names := make(map[string]bool)
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		return names
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if se, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := se.X.(*ast.Ident); ok {
+				names[id.Name] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// renameImports renames references to imports, both selectors and replaced identifiers
+func renameImports(df *dst.File, rename map[string]string) {
+	dst.Inspect(df, func(n dst.Node) bool {
+		switch x := n.(type) {
+		case *dst.ImportSpec:
+			return false
+		case *dst.SelectorExpr:
+			if id, ok := x.X.(*dst.Ident); ok {
+				if name, ok := rename[id.Name]; ok {
+					id.Name = name
+				}
+			}
+		case *dst.Ident:
+			if strings.Contains(x.Name, ".") {
+				for old, name := range rename {
+					x.Name = replaceQualifier(x.Name, old, name)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// replaceQualifier replaces the package name old qualifying types in the expression s
+func replaceQualifier(s, old, name string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], old+".") && (i == 0 || !isIdentByte(s[i-1])) {
+			b.WriteString(name)
+			i += len(old)
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+// importsC reports whether gd imports "C", which is left alone for the preamble of cgo
+func importsC(gd *dst.GenDecl) bool {
+	for _, s := range gd.Specs {
+		if importPath(s.(*dst.ImportSpec)) == "C" {
+			return true
+		}
+	}
+	return false
+}
+
+// aliased reports whether an import is named other than its package
+func aliased(s *dst.ImportSpec) bool {
+	return s.Name != nil && s.Name.Name != "" && s.Name.Name != packageName(importPath(s))
+}
+
+// importName returns the name an import is referred to by, ok is false if the
+// import isn't named and the name of its package can't be determined
+func importName(s *dst.ImportSpec) (name string, ok bool) {
+	if s.Name != nil && s.Name.Name != "" {
+		return s.Name.Name, true
+	}
+	name = packageName(importPath(s))
+	return name, name != ""
+}
+
+// packageNames caches the names declared by packages, keyed by import path
+var packageNames = make(map[string]string)
+
+// packageName returns the name declared by the package of path, which may differ from
+// the last element of path like for gopkg.in/yaml.v2 and math/rand/v2. The package is
+// looked up from the current directory, empty string is returned if it can't be loaded.
+func packageName(path string) string {
+	if name, ok := packageNames[path]; ok {
+		return name
+	}
+	var name string
+	if bp, err := build.Import(path, ".", 0); err == nil {
+		name = bp.Name
+	}
+	packageNames[path] = name
+	return name
+}
+
+func importPath(s *dst.ImportSpec) string {
+	path, err := strconv.Unquote(s.Path.Value)
+	if err != nil {
+		return s.Path.Value
+	}
+	return path
+}
+
+// isStdlib reports whether path is of the standard library, i.e., its first element has no dot
+func isStdlib(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
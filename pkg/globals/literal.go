@@ -0,0 +1,37 @@
+package globals
+
+import (
+	"github.com/dave/dst"
+)
+
+// LiteralUse is a basic literal used as a value of a global type
+type LiteralUse struct {
+	// Lit is either a *dst.BasicLit or a *dst.UnaryExpr of a signed *dst.BasicLit
+	Lit dst.Expr
+	// TypeName is the name of the global type
+	TypeName string
+	// Cmp is the comparison if the literal is an operand of == or !=
+	Cmp *dst.BinaryExpr
+}
+
+// FindLiterals finds all basic literals used as a value of the global types in typeNames,
+// i.e., in returns, assignments, comparisons, composite literals and call arguments.
+func FindLiterals(df *dst.File, typeNames []string) (uses []LiteralUse) {
+	nmap := make(map[string]struct{})
+	for _, name := range typeNames {
+		nmap[name] = struct{}{}
+	}
+
+	v := walker{
+		df: df,
+		f:  func(*dst.Ident, SymKind) {},
+		litf: func(lit dst.Expr, typeName string, cmp *dst.BinaryExpr) {
+			if _, ok := nmap[typeName]; ok {
+				uses = append(uses, LiteralUse{Lit: lit, TypeName: typeName, Cmp: cmp})
+			}
+		},
+	}
+
+	v.walk()
+	return
+}
@@ -0,0 +1,349 @@
+package globals
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+)
+
+var (
+	// ErrMember when a method or field to rename is not declared by the type
+	ErrMember = errors.New("no such member")
+	// ErrMemberCollision when a method or field is renamed to an existing one
+	ErrMemberCollision = errors.New("member name collision")
+)
+
+// RenameMembers renames methods and fields of the types declared in df, keys are like List.PushFront
+// for methods and Entry.next for fields. The declarations and all uses are renamed, i.e., selectors
+// including method values and method expressions like (*List).PushFront, and keys of composite literals.
+// Renaming a method of an interface also renames the methods implementing it in df.
+//
+// Uses are resolved by their types, so unrelated members with the same name are left alone.
+// Selectors whose types are unknown, e.g. for packages that can't be loaded, are renamed
+// by name if no other member in df has the name.
+func RenameMembers(df *dst.File, methods, fields map[string]string) (err error) {
+	if len(methods) == 0 && len(fields) == 0 {
+		return
+	}
+
+	r, f, info, pkg, err := typeCheck(df)
+	if err != nil {
+		return
+	}
+
+	targets := make(map[types.Object]string)
+	add := func(members map[string]string, method bool) error {
+		for _, key := range sortedKeys(members) {
+			obj, err := lookupMember(pkg, key, method)
+			if err != nil {
+				return err
+			}
+			targets[obj] = members[key]
+		}
+		return nil
+	}
+	if err = add(methods, true); err != nil {
+		return
+	}
+	if err = add(fields, false); err != nil {
+		return
+	}
+	addImplementations(pkg, targets)
+	if err = checkMembers(pkg, targets); err != nil {
+		return
+	}
+
+	renamed := make(map[string]string) // old name -> new name, for those resolved by name
+	for obj, name := range targets {
+		if prev, ok := renamed[obj.Name()]; ok && prev != name {
+			renamed[obj.Name()] = ""
+		} else {
+			renamed[obj.Name()] = name
+		}
+	}
+	for name := range localMembers(pkg, targets) {
+		delete(renamed, name)
+	}
+
+	rename := func(id *ast.Ident, obj types.Object) {
+		if obj == nil {
+			return
+		}
+		if name, ok := targets[origin(obj)]; ok {
+			if did, ok := r.Dst.Nodes[id].(*dst.Ident); ok {
+				did.Name = name
+			}
+		}
+	}
+	for id, obj := range info.Defs {
+		rename(id, obj)
+	}
+	for id, obj := range info.Uses {
+		rename(id, obj)
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			if info.Selections[x] != nil || info.Uses[x.Sel] != nil {
+				return true
+			}
+			if name := renamed[x.Sel.Name]; name != "" {
+				r.Dst.Nodes[x.Sel].(*dst.Ident).Name = name
+			}
+		case *ast.FuncDecl:
+			// doc comments of renamed methods
+			if obj := info.Defs[x.Name]; obj != nil && x.Recv != nil {
+				if name, ok := targets[obj]; ok {
+					fd := r.Dst.Nodes[x].(*dst.FuncDecl)
+					for i, comment := range fd.Decs.Start {
+						fd.Decs.Start[i] = strings.ReplaceAll(comment, obj.Name(), name)
+					}
+				}
+			}
+		}
+		return true
+	})
+	return
+}
+
+// MethodUses returns the uses of methods outside of their declarations, i.e., selectors
+// including promoted ones, method values and method expressions, in the order of df.
+// Like in RenameMembers, uses are resolved by their types.
+func MethodUses(df *dst.File, methods []*dst.FuncDecl) (uses []*dst.Ident, err error) {
+	if len(methods) == 0 {
+		return
+	}
+
+	r, _, info, _, err := typeCheck(df)
+	if err != nil {
+		return
+	}
+
+	targets := make(map[types.Object]bool)
+	var decls []ast.Node
+	for _, fd := range methods {
+		afd, ok := r.Ast.Nodes[fd].(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		decls = append(decls, afd)
+		if obj := info.Defs[afd.Name]; obj != nil {
+			targets[obj] = true
+		}
+	}
+	inDecls := func(id *ast.Ident) bool {
+		for _, d := range decls {
+			if d.Pos() <= id.Pos() && id.End() <= d.End() {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ids []*ast.Ident
+	for id, obj := range info.Uses {
+		if obj != nil && targets[origin(obj)] && !inDecls(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+	for _, id := range ids {
+		if did, ok := r.Dst.Nodes[id].(*dst.Ident); ok {
+			uses = append(uses, did)
+		}
+	}
+	return
+}
+
+// typeCheck type checks df, errors are ignored since the caller resolves what it can
+func typeCheck(df *dst.File) (r *decorator.Restorer, f *ast.File, info *types.Info, pkg *types.Package, err error) {
+	r = decorator.NewRestorer()
+	if f, err = r.RestoreFile(df); err != nil {
+		return
+	}
+	info = &types.Info{
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(r.Fset, "source", nil),
+		Error:    func(error) {},
+	}
+	pkg, _ = conf.Check(df.Name.Name, r.Fset, []*ast.File{f}, info)
+	return
+}
+
+// lookupMember returns the method or field declared by a type of pkg, key is like List.PushFront
+func lookupMember(pkg *types.Package, key string, method bool) (obj types.Object, err error) {
+	kind := "field"
+	if method {
+		kind = "method"
+	}
+	i := strings.Index(key, ".")
+	if i == -1 {
+		err = fmt.Errorf("%v: %s, want Type.%s", ErrMember, key, kind)
+		return
+	}
+	tn, ok := pkg.Scope().Lookup(key[:i]).(*types.TypeName)
+	if !ok {
+		err = fmt.Errorf("%v: %s, %s is not a type", ErrMember, key, key[:i])
+		return
+	}
+	obj, index, _ := types.LookupFieldOrMethod(tn.Type(), true, pkg, key[i+1:])
+	if _, isMethod := obj.(*types.Func); obj == nil || len(index) != 1 || isMethod != method {
+		err = fmt.Errorf("%v: %s has no %s %s", ErrMember, key[:i], kind, key[i+1:])
+		return
+	}
+	if v, ok := obj.(*types.Var); ok && v.Embedded() {
+		err = fmt.Errorf("%v: %s is embedded, rename the type instead", ErrMember, key)
+		return
+	}
+	return
+}
+
+// addImplementations adds the methods of types in pkg implementing renamed interface methods
+func addImplementations(pkg *types.Package, targets map[types.Object]string) {
+	var ifaceMethods []*types.Func
+	for obj := range targets {
+		if fn, ok := obj.(*types.Func); ok {
+			if _, ok := recvNamed(fn).Underlying().(*types.Interface); ok {
+				ifaceMethods = append(ifaceMethods, fn)
+			}
+		}
+	}
+	for _, fn := range ifaceMethods {
+		iface := recvNamed(fn).Underlying().(*types.Interface)
+		for _, name := range pkg.Scope().Names() {
+			tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+			if !ok || types.IsInterface(tn.Type()) {
+				continue
+			}
+			if named, ok := tn.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+				continue
+			}
+			if !types.Implements(types.NewPointer(tn.Type()), iface) {
+				continue
+			}
+			m, index, _ := types.LookupFieldOrMethod(tn.Type(), true, pkg, fn.Name())
+			if m != nil && len(index) == 1 && m.Pkg() == pkg {
+				if _, ok := targets[m]; !ok {
+					targets[m] = targets[fn]
+				}
+			}
+		}
+	}
+}
+
+// checkMembers reports members renamed to existing ones of the same type
+func checkMembers(pkg *types.Package, targets map[types.Object]string) error {
+	var collisions []string
+	for obj, name := range targets {
+		var t types.Type
+		if fn, ok := obj.(*types.Func); ok {
+			t = recvNamed(fn)
+		} else {
+			t = fieldOwner(pkg, obj.(*types.Var))
+		}
+		if t == nil {
+			continue
+		}
+		if existing, _, _ := types.LookupFieldOrMethod(t, true, pkg, name); existing != nil && existing != obj {
+			if _, renamed := targets[existing]; !renamed {
+				collisions = append(collisions, fmt.Sprintf("%s.%s renamed to existing %s", types.TypeString(t, types.RelativeTo(pkg)), obj.Name(), name))
+			}
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return fmt.Errorf("%v: %s", ErrMemberCollision, strings.Join(collisions, "; "))
+	}
+	return nil
+}
+
+// localMembers returns the names of methods and fields of types in pkg other than targets
+func localMembers(pkg *types.Package, targets map[types.Object]string) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range pkg.Scope().Names() {
+		tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		if named, ok := tn.Type().(*types.Named); ok {
+			for i := 0; i < named.NumMethods(); i++ {
+				if _, ok := targets[named.Method(i)]; !ok {
+					names[named.Method(i).Name()] = true
+				}
+			}
+		}
+		switch u := tn.Type().Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < u.NumFields(); i++ {
+				if _, ok := targets[u.Field(i)]; !ok {
+					names[u.Field(i).Name()] = true
+				}
+			}
+		case *types.Interface:
+			for i := 0; i < u.NumExplicitMethods(); i++ {
+				if _, ok := targets[u.ExplicitMethod(i)]; !ok {
+					names[u.ExplicitMethod(i).Name()] = true
+				}
+			}
+		}
+	}
+	return names
+}
+
+// recvNamed returns the type declaring method fn
+func recvNamed(fn *types.Func) types.Type {
+	t := fn.Type().(*types.Signature).Recv().Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	return t
+}
+
+// fieldOwner returns the type of pkg declaring field v
+func fieldOwner(pkg *types.Package, v *types.Var) types.Type {
+	for _, name := range pkg.Scope().Names() {
+		tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		if st, ok := tn.Type().Underlying().(*types.Struct); ok {
+			for i := 0; i < st.NumFields(); i++ {
+				if st.Field(i) == v {
+					return tn.Type()
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// origin returns the generic method or field of an instantiated one
+func origin(obj types.Object) types.Object {
+	switch x := obj.(type) {
+	case *types.Func:
+		return x.Origin()
+	case *types.Var:
+		return x.Origin()
+	}
+	return obj
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
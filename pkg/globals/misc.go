@@ -3,8 +3,10 @@ package globals
 import (
 	"fmt"
 	"go/ast"
+	"go/parser"
 	"go/token"
 	"path/filepath"
+	"sort"
 	"strconv"
 
 	"github.com/dave/dst"
@@ -42,6 +44,32 @@ func GetImportMap(f *ast.File) (m map[string]string /* import name -> path*/) {
 	return
 }
 
+// GetImportMapDst is like GetImportMap but for dst.File
+func GetImportMapDst(df *dst.File) (m map[string]string /* import name -> path*/) {
+	m = make(map[string]string)
+
+	for _, decl := range df.Decls {
+		d, ok := decl.(*dst.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+
+		for _, gs := range d.Specs {
+			s := gs.(*dst.ImportSpec)
+			path, err := strconv.Unquote(s.Path.Value)
+			if err != nil {
+				panic(fmt.Sprintf("strconv.Unquote:%v", err))
+			}
+			if s.Name != nil {
+				m[s.Name.Name] = path
+			} else {
+				m[filepath.Base(path)] = path
+			}
+		}
+	}
+	return
+}
+
 // WalkGlobalsDst will walk over all global identifiers
 func WalkGlobalsDst(df *dst.File, f func(name string, kind SymKind) bool) (err error) {
 	for _, d := range df.Decls {
@@ -98,29 +126,71 @@ func WalkGlobalsDst(df *dst.File, f func(name string, kind SymKind) bool) (err e
 	return
 }
 
-// AddImports for add imports to file
+// AddImports for add imports to file, they're added to the first import block in the order of
+// the names, and those whose paths are imported already are skipped
 func AddImports(df *dst.File, imports map[string]string) {
-	specs := make([]dst.Spec, 0, len(imports))
-	for name, path := range imports {
-		if name == filepath.Base(path) {
-			name = ""
+	have := make(map[string]bool)
+	for _, path := range GetImportMapDst(df) {
+		have[path] = true
+	}
+	names := make([]string, 0, len(imports))
+	for name := range imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var specs []dst.Spec
+	for _, name := range names {
+		path := imports[name]
+		if have[path] {
+			continue
 		}
-		specs = append(specs, &dst.ImportSpec{
-			Name: &dst.Ident{Name: name},
-			Path: &dst.BasicLit{Value: strconv.Quote(path)},
-		})
+		have[path] = true
+		spec := &dst.ImportSpec{Path: &dst.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}}
+		if name != filepath.Base(path) {
+			spec.Name = dst.NewIdent(name)
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return
 	}
 
+	for _, d := range df.Decls {
+		if gd, ok := d.(*dst.GenDecl); ok && gd.Tok == token.IMPORT && !importsC(gd) {
+			gd.Specs = append(gd.Specs, specs...)
+			gd.Lparen = true
+			return
+		}
+	}
 	d := &dst.GenDecl{
 		Tok:    token.IMPORT,
 		Specs:  specs,
 		Lparen: true,
 	}
+	df.Decls = append([]dst.Decl{d}, df.Decls...)
+}
 
-	newDecls := make([]dst.Decl, 0, len(df.Decls)+1)
-	newDecls = append(newDecls, d)
-	newDecls = append(newDecls, df.Decls...)
-	df.Decls = newDecls
+// RemoveUnusedImports removes imports not referred to by any declaration, returns the removed import names.
+// Imports whose package names can't be determined are kept.
+func RemoveUnusedImports(df *dst.File) (removed []string) {
+	used := usedImports(df)
+	nodes := make(map[dst.Node]bool)
+	for _, d := range df.Decls {
+		gd, ok := d.(*dst.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		for _, s := range gd.Specs {
+			s := s.(*dst.ImportSpec)
+			if name, ok := importName(s); ok && name != "_" && name != "." && !used[name] {
+				removed = append(removed, name)
+				nodes[s] = true
+			}
+		}
+	}
+	RemoveNodes(df, nodes)
+	return
 }
 
 // UpdateConstValue for update global constant value
@@ -289,6 +359,112 @@ func RemoveDecl(df *dst.File, names []string) {
 	}
 }
 
+// TypeSpecs returns the specs declaring the types in names
+func TypeSpecs(df *dst.File, names []string) (specs []*dst.TypeSpec) {
+	nmap := make(map[string]bool)
+	for _, name := range names {
+		nmap[name] = true
+	}
+	for _, d := range df.Decls {
+		gd, ok := d.(*dst.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range gd.Specs {
+			if ts := s.(*dst.TypeSpec); nmap[ts.Name.Name] {
+				specs = append(specs, ts)
+			}
+		}
+	}
+	return
+}
+
+// MethodsOf returns the methods declared on the types in names
+func MethodsOf(df *dst.File, names []string) (methods []*dst.FuncDecl) {
+	nmap := make(map[string]bool)
+	for _, name := range names {
+		nmap[name] = true
+	}
+	for _, d := range df.Decls {
+		if fd, ok := d.(*dst.FuncDecl); ok && fd.Recv != nil && nmap[RecvTypeName(fd)] {
+			methods = append(methods, fd)
+		}
+	}
+	return
+}
+
+// RemoveNodes removes the given declarations and specs, unlike RemoveDecl it doesn't
+// depend on names, which may have been changed, or shared by other declarations
+func RemoveNodes(df *dst.File, nodes map[dst.Node]bool) {
+	var decls []dst.Decl
+	for _, d := range df.Decls {
+		switch td := d.(type) {
+		case *dst.FuncDecl:
+			if nodes[td] {
+				continue
+			}
+		case *dst.GenDecl:
+			if nodes[td] {
+				continue
+			}
+			var specs []dst.Spec
+			for _, s := range td.Specs {
+				if !nodes[s] {
+					specs = append(specs, s)
+				}
+			}
+			if len(specs) == 0 && len(td.Specs) > 0 {
+				continue
+			}
+			td.Specs = specs
+		}
+		decls = append(decls, d)
+	}
+	df.Decls = decls
+}
+
+// ParenthesizeTypes adds parentheses around identifiers replaced by type expressions where the
+// expressions would be parsed differently otherwise, i.e., conversions like (*T)(x), (<-chan T)(x)
+// and (func())(x), and method expressions like (*T).Method
+func ParenthesizeTypes(df *dst.File) {
+	dst.Inspect(df, func(n dst.Node) bool {
+		switch x := n.(type) {
+		case *dst.CallExpr:
+			if id, ok := x.Fun.(*dst.Ident); ok && needsParens(id.Name, true) {
+				x.Fun = &dst.ParenExpr{X: id}
+			}
+		case *dst.SelectorExpr:
+			if id, ok := x.X.(*dst.Ident); ok && needsParens(id.Name, false) {
+				x.X = &dst.ParenExpr{X: id}
+			}
+		}
+		return true
+	})
+}
+
+// needsParens reports whether the type expression s needs parentheses as the function of a
+// conversion, or as the operand of a selector
+func needsParens(s string, conversion bool) bool {
+	if token.IsIdentifier(s) {
+		return false
+	}
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		return false
+	}
+	switch x := expr.(type) {
+	case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr, *ast.ParenExpr:
+		return false
+	case *ast.StarExpr:
+		return true
+	case *ast.ChanType:
+		return !conversion || x.Dir == ast.RECV
+	case *ast.FuncType:
+		return !conversion || x.Results == nil
+	}
+	return !conversion
+}
+
 // UpdateComment for update comment of global declares
 func UpdateComment(df *dst.File, cf func(name string, node dst.Node)) {
 	for _, d := range df.Decls {
@@ -0,0 +1,193 @@
+package globals
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/dstutil"
+)
+
+// NilUse is a nil used as a value of a global type
+type NilUse struct {
+	// Nil is the nil identifier
+	Nil *dst.Ident
+	// TypeName is the name of the global type
+	TypeName string
+	// Cmp is the comparison if nil is an operand of == or !=
+	Cmp *dst.BinaryExpr
+}
+
+// FindNil finds all nil used as a value of the global types in typeNames,
+// i.e., in returns, assignments, comparisons, composite literals and call arguments.
+func FindNil(df *dst.File, typeNames []string) (uses []NilUse) {
+	nmap := make(map[string]struct{})
+	for _, name := range typeNames {
+		nmap[name] = struct{}{}
+	}
+
+	v := walker{
+		df: df,
+		f:  func(*dst.Ident, SymKind) {},
+		nilf: func(nilIdent *dst.Ident, typeName string, cmp *dst.BinaryExpr) {
+			if _, ok := nmap[typeName]; ok {
+				uses = append(uses, NilUse{Nil: nilIdent, TypeName: typeName, Cmp: cmp})
+			}
+		},
+	}
+
+	v.walk()
+	return
+}
+
+// ReplaceNil replaces each nil identifier in m with the corresponding expression
+func ReplaceNil(df *dst.File, m map[*dst.Ident]dst.Expr) {
+	if len(m) == 0 {
+		return
+	}
+
+	dstutil.Apply(df, func(c *dstutil.Cursor) bool {
+		id, ok := c.Node().(*dst.Ident)
+		if !ok {
+			return true
+		}
+		if e, ok := m[id]; ok {
+			c.Replace(e)
+		}
+		return true
+	}, nil)
+}
+
+// Nilable reports whether nil is a valid value for the type expression target.
+// Types defined in df are resolved to their definitions, qualified types are resolved by importing
+// their packages from source, imports maps import name to path for those not imported by df.
+// Types that can't be resolved are assumed to be nilable.
+func Nilable(df *dst.File, target string, imports map[string]string) bool {
+	expr, err := parser.ParseExpr(target)
+	if err != nil {
+		return true
+	}
+	node, err := decorator.NewDecorator(token.NewFileSet()).DecorateNode(expr)
+	if err != nil {
+		return true
+	}
+
+	defs := make(map[string]dst.Expr)
+	for _, d := range df.Decls {
+		if gd, ok := d.(*dst.GenDecl); ok && gd.Tok == token.TYPE {
+			for _, s := range gd.Specs {
+				s := s.(*dst.TypeSpec)
+				defs[s.Name.Name] = s.Type
+			}
+		}
+	}
+
+	importMap := GetImportMapDst(df)
+	for name, path := range imports {
+		importMap[name] = path
+	}
+	n := nilChecker{defs: defs, imports: importMap, importer: importer.ForCompiler(token.NewFileSet(), "source", nil)}
+	return n.nilable(node.(dst.Expr), 0)
+}
+
+// nilChecker finds out whether type expressions are nilable
+type nilChecker struct {
+	defs     map[string]dst.Expr
+	imports  map[string]string
+	importer types.Importer
+}
+
+func (n *nilChecker) nilable(e dst.Expr, depth int) bool {
+	switch te := e.(type) {
+	case *dst.StarExpr, *dst.MapType, *dst.ChanType, *dst.FuncType, *dst.InterfaceType:
+		return true
+	case *dst.ArrayType:
+		return te.Len == nil
+	case *dst.StructType:
+		return false
+	case *dst.ParenExpr:
+		return n.nilable(te.X, depth)
+	case *dst.IndexExpr:
+		return n.nilable(te.X, depth)
+	case *dst.IndexListExpr:
+		return n.nilable(te.X, depth)
+	case *dst.SelectorExpr:
+		return n.qualifiedNilable(te)
+	case *dst.Ident:
+		if def, ok := n.defs[te.Name]; ok {
+			if depth > maxTypeDepth {
+				return true
+			}
+			return n.nilable(def, depth+1)
+		}
+		tn, ok := types.Universe.Lookup(te.Name).(*types.TypeName)
+		if !ok {
+			return true
+		}
+		return typeNilable(tn.Type())
+	default:
+		return true
+	}
+}
+
+// qualifiedNilable resolves a type of another package, which is assumed to be nilable if it can't be imported
+func (n *nilChecker) qualifiedNilable(se *dst.SelectorExpr) bool {
+	id, ok := se.X.(*dst.Ident)
+	if !ok {
+		return true
+	}
+	path := n.imports[id.Name]
+	if path == "" {
+		return true
+	}
+	pkg, err := n.importer.Import(path)
+	if err != nil {
+		return true
+	}
+	tn, ok := pkg.Scope().Lookup(se.Sel.Name).(*types.TypeName)
+	if !ok {
+		return true
+	}
+	return typeNilable(tn.Type())
+}
+
+// typeNilable reports whether nil is a valid value of t
+func typeNilable(t types.Type) bool {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u.Kind() == types.UnsafePointer
+	case *types.Struct, *types.Array:
+		return false
+	}
+	return true
+}
+
+// ZeroValue returns an expression for the zero value of global type typeName
+// which will be replaced by target.
+//
+// For predeclared basic types a literal is used, otherwise it's *new(typeName),
+// which becomes *new(target) once typeName is renamed.
+func ZeroValue(typeName, target string) dst.Expr {
+	if expr, err := parser.ParseExpr(target); err == nil {
+		if id, ok := expr.(*ast.Ident); ok {
+			if tn, ok := types.Universe.Lookup(id.Name).(*types.TypeName); ok {
+				if b, ok := tn.Type().(*types.Basic); ok {
+					switch {
+					case b.Info()&types.IsNumeric != 0:
+						return &dst.BasicLit{Kind: token.INT, Value: "0"}
+					case b.Info()&types.IsString != 0:
+						return &dst.BasicLit{Kind: token.STRING, Value: `""`}
+					case b.Info()&types.IsBoolean != 0:
+						return dst.NewIdent("false")
+					}
+				}
+			}
+		}
+	}
+
+	return &dst.StarExpr{X: &dst.CallExpr{Fun: dst.NewIdent("new"), Args: []dst.Expr{dst.NewIdent(typeName)}}}
+}
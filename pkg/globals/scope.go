@@ -1,5 +1,7 @@
 package globals
 
+import "github.com/dave/dst"
+
 // SymKind specifies the kind of a global symbol. For example, a variable, const
 // function, etc.
 type SymKind int
@@ -15,11 +17,34 @@ const (
 	KindReceiver
 	KindParameter
 	KindResult
+	KindTypeParam
 )
 
+var kindNames = map[SymKind]string{
+	KindFunc:      "func",
+	KindImport:    "import",
+	KindType:      "type",
+	KindConst:     "const",
+	KindVar:       "var",
+	KindReceiver:  "receiver",
+	KindParameter: "parameter",
+	KindResult:    "result",
+	KindTypeParam: "type parameter",
+}
+
+func (k SymKind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 type symbol struct {
 	kind  SymKind
 	scope *scope
+	// typ is the declared type of the symbol if known,
+	// for types it's the type definition, for funcs it's the FuncType.
+	typ dst.Expr
 }
 
 type scope struct {
@@ -51,13 +76,17 @@ func (s *scope) deepLookup(n string) *symbol {
 	return nil
 }
 
-func (s *scope) add(name string, kind SymKind) {
-	if s.syms[name] != nil {
+func (s *scope) add(name string, kind SymKind, typ dst.Expr) {
+	if sym := s.syms[name]; sym != nil {
+		if sym.typ == nil {
+			sym.typ = typ
+		}
 		return
 	}
 
 	s.syms[name] = &symbol{
 		kind:  kind,
 		scope: s,
+		typ:   typ,
 	}
 }
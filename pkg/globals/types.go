@@ -0,0 +1,313 @@
+package globals
+
+import (
+	"go/token"
+	"go/types"
+
+	"github.com/dave/dst"
+)
+
+// maxTypeDepth limits how deep type definitions are followed
+const maxTypeDepth = 16
+
+// typeOf returns the declared type of e as written in the file, or nil if unknown.
+//
+// It's not a type checker, only the forms needed to find out the type of
+// variables, fields, results and elements are understood.
+func (w *walker) typeOf(e dst.Expr) dst.Expr {
+	switch te := e.(type) {
+	case *dst.Ident:
+		s := w.scope.deepLookup(te.Name)
+		if s == nil || s.kind == KindType || s.kind == KindTypeParam || s.kind == KindImport {
+			return nil
+		}
+		return s.typ
+	case *dst.ParenExpr:
+		return w.typeOf(te.X)
+	case *dst.StarExpr:
+		if st, ok := w.underlying(w.typeOf(te.X)).(*dst.StarExpr); ok {
+			return st.X
+		}
+	case *dst.UnaryExpr:
+		switch te.Op {
+		case token.AND:
+			if t := w.typeOf(te.X); t != nil {
+				return &dst.StarExpr{X: t}
+			}
+		case token.ARROW:
+			if ct, ok := w.underlying(w.typeOf(te.X)).(*dst.ChanType); ok {
+				return ct.Value
+			}
+		default:
+			return w.typeOf(te.X)
+		}
+	case *dst.SelectorExpr:
+		return w.selectorType(w.typeOf(te.X), te.Sel.Name, 0)
+	case *dst.CallExpr:
+		if w.isTypeExpr(te.Fun) {
+			return te.Fun
+		}
+		if id, ok := te.Fun.(*dst.Ident); ok && id.Name == "new" && len(te.Args) == 1 && w.scope.deepLookup(id.Name) == nil {
+			return &dst.StarExpr{X: te.Args[0]}
+		}
+		if ft := w.funcTypeOf(te.Fun); ft != nil {
+			if results := fieldTypes(ft.Results); len(results) == 1 {
+				return results[0]
+			}
+		}
+	case *dst.CompositeLit:
+		return te.Type
+	case *dst.IndexExpr:
+		switch t := w.underlying(w.typeOf(te.X)).(type) {
+		case *dst.ArrayType:
+			return t.Elt
+		case *dst.MapType:
+			return t.Value
+		case *dst.FuncType:
+			// an instantiated generic function
+			return t
+		}
+	case *dst.IndexListExpr:
+		if ft, ok := w.underlying(w.typeOf(te.X)).(*dst.FuncType); ok {
+			return ft
+		}
+	case *dst.SliceExpr:
+		return w.typeOf(te.X)
+	case *dst.TypeAssertExpr:
+		return te.Type
+	case *dst.FuncLit:
+		return te.Type
+	}
+	return nil
+}
+
+// underlying follows the definitions of types defined in the file
+func (w *walker) underlying(t dst.Expr) dst.Expr {
+	for i := 0; i < maxTypeDepth; i++ {
+		switch tt := t.(type) {
+		case *dst.ParenExpr:
+			t = tt.X
+		case *dst.IndexExpr, *dst.IndexListExpr:
+			// type arguments are not substituted
+			t = genericBase(tt)
+		case *dst.Ident:
+			s := w.scope.deepLookup(tt.Name)
+			if s == nil || s.kind != KindType || s.typ == nil {
+				return t
+			}
+			t = s.typ
+		default:
+			return t
+		}
+	}
+	return t
+}
+
+// isTypeExpr reports whether e denotes a type, e.g. the Fun of a conversion
+func (w *walker) isTypeExpr(e dst.Expr) bool {
+	switch te := e.(type) {
+	case *dst.Ident:
+		if s := w.scope.deepLookup(te.Name); s != nil {
+			return s.kind == KindType || s.kind == KindTypeParam
+		}
+		_, ok := types.Universe.Lookup(te.Name).(*types.TypeName)
+		return ok
+	case *dst.ParenExpr:
+		return w.isTypeExpr(te.X)
+	case *dst.StarExpr:
+		return w.isTypeExpr(te.X)
+	case *dst.IndexExpr, *dst.IndexListExpr:
+		return w.isTypeExpr(genericBase(te))
+	case *dst.ArrayType, *dst.MapType, *dst.ChanType, *dst.FuncType, *dst.InterfaceType, *dst.StructType:
+		return true
+	}
+	return false
+}
+
+// selectorType returns the type of field or method name of type t
+func (w *walker) selectorType(t dst.Expr, name string, depth int) dst.Expr {
+	if t == nil || depth > maxTypeDepth {
+		return nil
+	}
+	if st, ok := w.underlying(t).(*dst.StarExpr); ok {
+		t = st.X
+	}
+	if id := GetIdentDst(genericBase(t)); id != nil {
+		if ft := w.methods[id.Name][name]; ft != nil {
+			return ft
+		}
+	}
+	st, ok := w.underlying(t).(*dst.StructType)
+	if !ok || st.Fields == nil {
+		return nil
+	}
+	for _, f := range st.Fields.List {
+		for _, n := range f.Names {
+			if n.Name == name {
+				return f.Type
+			}
+		}
+	}
+	// promoted fields and methods
+	for _, f := range st.Fields.List {
+		if len(f.Names) > 0 {
+			continue
+		}
+		if ft := w.selectorType(f.Type, name, depth+1); ft != nil {
+			return ft
+		}
+	}
+	return nil
+}
+
+// funcTypeOf returns the FuncType of a callee
+func (w *walker) funcTypeOf(fun dst.Expr) *dst.FuncType {
+	ft, _ := w.underlying(w.typeOf(fun)).(*dst.FuncType)
+	return ft
+}
+
+// paramTypes returns the parameter type for each argument of ce
+func (w *walker) paramTypes(ce *dst.CallExpr) []dst.Expr {
+	ft := w.funcTypeOf(ce.Fun)
+	if ft == nil {
+		return nil
+	}
+	params := fieldTypes(ft.Params)
+	if len(params) == 0 {
+		return nil
+	}
+	if ell, ok := params[len(params)-1].(*dst.Ellipsis); ok && !ce.Ellipsis {
+		params = params[:len(params)-1]
+		for len(params) < len(ce.Args) {
+			params = append(params, ell.Elt)
+		}
+	}
+	return params
+}
+
+// assignTypes returns the types of n variables assigned from values
+func (w *walker) assignTypes(n int, values []dst.Expr) []dst.Expr {
+	result := make([]dst.Expr, n)
+	if len(values) == n {
+		for i, v := range values {
+			result[i] = w.typeOf(v)
+		}
+		return result
+	}
+	if len(values) != 1 {
+		return result
+	}
+
+	switch v := values[0].(type) {
+	case *dst.CallExpr:
+		if ft := w.funcTypeOf(v.Fun); ft != nil {
+			if results := fieldTypes(ft.Results); len(results) == n {
+				copy(result, results)
+			}
+		}
+	case *dst.IndexExpr, *dst.TypeAssertExpr, *dst.UnaryExpr:
+		if n == 2 {
+			result[0] = w.typeOf(v)
+			result[1] = dst.NewIdent("bool")
+		}
+	}
+	return result
+}
+
+// rangeTypes returns the key and value types when ranging over x
+func (w *walker) rangeTypes(x dst.Expr) (keyType, valueType dst.Expr) {
+	t := w.underlying(w.typeOf(x))
+	if st, ok := t.(*dst.StarExpr); ok {
+		t = w.underlying(st.X)
+	}
+	switch tt := t.(type) {
+	case *dst.ArrayType:
+		return dst.NewIdent("int"), tt.Elt
+	case *dst.MapType:
+		return tt.Key, tt.Value
+	case *dst.ChanType:
+		return tt.Value, nil
+	case *dst.Ident:
+		if tt.Name == "string" {
+			return dst.NewIdent("int"), dst.NewIdent("rune")
+		}
+	}
+	return
+}
+
+// eltType returns the type of the i-th element of a composite literal
+func (w *walker) eltType(litType dst.Expr, key dst.Expr, i int) dst.Expr {
+	switch t := w.underlying(litType).(type) {
+	case *dst.StructType:
+		if key != nil {
+			id, ok := key.(*dst.Ident)
+			if !ok {
+				return nil
+			}
+			return w.selectorType(litType, id.Name, 0)
+		}
+		if fields := fieldTypes(t.Fields); i < len(fields) {
+			return fields[i]
+		}
+	case *dst.ArrayType:
+		return t.Elt
+	case *dst.MapType:
+		return t.Value
+	}
+	return nil
+}
+
+// elidedType returns the type of a composite literal whose type is elided as an element of type t,
+// i.e., T for an element of type *T
+func elidedType(t dst.Expr) dst.Expr {
+	if st, ok := t.(*dst.StarExpr); ok {
+		return st.X
+	}
+	return t
+}
+
+// checkValue calls nilf or litf if e is nil or a literal used as a value of a global type
+func (w *walker) checkValue(e dst.Expr, typ dst.Expr, cmp *dst.BinaryExpr) {
+	if (w.nilf == nil && w.litf == nil) || typ == nil {
+		return
+	}
+	tid, ok := typ.(*dst.Ident)
+	if !ok {
+		return
+	}
+	if s := w.scope.deepLookup(tid.Name); s == nil || s.kind != KindType || !s.scope.isGlobal() {
+		return
+	}
+
+	switch x := e.(type) {
+	case *dst.Ident:
+		if w.nilf != nil && x.Name == "nil" && w.scope.deepLookup(x.Name) == nil {
+			w.nilf(x, tid.Name, cmp)
+		}
+	case *dst.BasicLit:
+		if w.litf != nil {
+			w.litf(x, tid.Name, cmp)
+		}
+	case *dst.UnaryExpr:
+		if _, ok := x.X.(*dst.BasicLit); ok && w.litf != nil && (x.Op == token.SUB || x.Op == token.ADD) {
+			w.litf(x, tid.Name, cmp)
+		}
+	}
+}
+
+// fieldTypes returns one type per name in l
+func fieldTypes(l *dst.FieldList) (result []dst.Expr) {
+	if l == nil {
+		return
+	}
+	for _, f := range l.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			result = append(result, f.Type)
+		}
+	}
+	return
+}
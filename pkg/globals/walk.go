@@ -18,6 +18,21 @@ type walker struct {
 
 	// scope is the current scope as nodes are visited.
 	scope *scope
+
+	// nilf is called when nil is used as a value of a global type, optional.
+	nilf func(nilIdent *dst.Ident, typeName string, cmp *dst.BinaryExpr)
+
+	// litf is called when a basic literal, possibly signed, is used as a value of a global type, optional.
+	litf func(lit dst.Expr, typeName string, cmp *dst.BinaryExpr)
+
+	// unitf is called before visiting each declaration, or each spec of type declarations, optional.
+	unitf func(unit dst.Node)
+
+	// results is the result types of the current function.
+	results []dst.Expr
+
+	// methods maps type name to its methods.
+	methods map[string]map[string]*dst.FuncType
 }
 
 // pushScope creates a new scope and pushes it to the top of the scope stack.
@@ -41,16 +56,17 @@ func (w *walker) walkExpr(e dst.Expr) {
 		w.walkExpr(te.Elt)
 	case *dst.BasicLit:
 	case *dst.FuncLit:
+		results := w.results
+		w.results = fieldTypes(te.Type.Results)
 		w.pushScope()
 		w.walkFieldList(te.Type.Params, KindParameter)
 		w.walkFieldList(te.Type.Results, KindResult)
 		w.walkBlockStmt(te.Body)
 		w.popScope()
+		w.results = results
 	case *dst.CompositeLit:
 		w.walkExpr(te.Type)
-		for _, elt := range te.Elts {
-			w.walkExpr(elt)
-		}
+		w.walkCompositeLit(te, te.Type)
 	case *dst.ParenExpr:
 		w.walkExpr(te.X)
 	case *dst.SelectorExpr:
@@ -58,6 +74,11 @@ func (w *walker) walkExpr(e dst.Expr) {
 	case *dst.IndexExpr:
 		w.walkExpr(te.X)
 		w.walkExpr(te.Index)
+	case *dst.IndexListExpr:
+		w.walkExpr(te.X)
+		for _, index := range te.Indices {
+			w.walkExpr(index)
+		}
 	case *dst.SliceExpr:
 		w.walkExpr(te.X)
 		w.walkExpr(te.Low)
@@ -75,6 +96,10 @@ func (w *walker) walkExpr(e dst.Expr) {
 	case *dst.UnaryExpr:
 		w.walkExpr(te.X)
 	case *dst.BinaryExpr:
+		if te.Op == token.EQL || te.Op == token.NEQ {
+			w.checkValue(te.Y, w.typeOf(te.X), te)
+			w.checkValue(te.X, w.typeOf(te.Y), te)
+		}
 		w.walkExpr(te.X)
 		w.walkExpr(te.Y)
 	case *dst.KeyValueExpr:
@@ -97,6 +122,31 @@ func (w *walker) walkExpr(e dst.Expr) {
 	}
 }
 
+// walkCompositeLit walks the elements of a composite literal of type litType, which is
+// implied by the enclosing literal if the type of an inner literal is elided
+func (w *walker) walkCompositeLit(cl *dst.CompositeLit, litType dst.Expr) {
+	for i, elt := range cl.Elts {
+		var key dst.Expr
+		value := elt
+		if kv, ok := elt.(*dst.KeyValueExpr); ok {
+			key, value = kv.Key, kv.Value
+		}
+		eltType := w.eltType(litType, key, i)
+		w.checkValue(value, eltType, nil)
+
+		if inner, ok := key.(*dst.CompositeLit); ok && inner.Type == nil {
+			if mt, ok := w.underlying(litType).(*dst.MapType); ok {
+				w.walkCompositeLit(inner, elidedType(mt.Key))
+			}
+		}
+		if inner, ok := value.(*dst.CompositeLit); ok && inner.Type == nil {
+			w.walkCompositeLit(inner, elidedType(eltType))
+		} else {
+			w.walkExpr(value)
+		}
+	}
+}
+
 func (w *walker) walkFieldList(l *dst.FieldList, kind SymKind) {
 	if l == nil {
 		return
@@ -105,17 +155,40 @@ func (w *walker) walkFieldList(l *dst.FieldList, kind SymKind) {
 	for _, f := range l.List {
 		for _, n := range f.Names {
 			if kind != KindUnknown {
-				w.scope.add(n.Name, kind)
+				w.scope.add(n.Name, kind, f.Type)
 			}
 		}
 		w.walkExpr(f.Type)
 	}
 }
 
+// addRecvTypeParams adds the type parameters of a generic receiver like List[K, V] to the scope
+func (w *walker) addRecvTypeParams(fd *dst.FuncDecl) {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return
+	}
+	var indices []dst.Expr
+	switch e := recvBase(fd.Recv.List[0].Type).(type) {
+	case *dst.IndexExpr:
+		indices = []dst.Expr{e.Index}
+	case *dst.IndexListExpr:
+		indices = e.Indices
+	}
+	for _, index := range indices {
+		if id, ok := index.(*dst.Ident); ok && id.Name != "_" {
+			w.scope.add(id.Name, KindTypeParam, nil)
+		}
+	}
+}
+
 func (w *walker) walkCallExpr(ce *dst.CallExpr) {
 	w.walkExpr(ce.Fun)
 
+	params := w.paramTypes(ce)
 	for i := 0; i < len(ce.Args); i++ {
+		if i < len(params) {
+			w.checkValue(ce.Args[i], params[i], nil)
+		}
 		w.walkExpr(ce.Args[i])
 	}
 }
@@ -130,19 +203,29 @@ func (w *walker) walkStmt(s dst.Stmt) {
 	case *dst.ExprStmt:
 		w.walkExpr(ts.X)
 	case *dst.SendStmt:
+		if ct, ok := w.underlying(w.typeOf(ts.Chan)).(*dst.ChanType); ok {
+			w.checkValue(ts.Value, ct.Value, nil)
+		}
 		w.walkExpr(ts.Chan)
 		w.walkExpr(ts.Value)
 	case *dst.IncDecStmt:
 		w.walkExpr(ts.X)
 	case *dst.AssignStmt:
-		for _, e := range ts.Rhs {
+		for i, e := range ts.Rhs {
+			if ts.Tok == token.ASSIGN && len(ts.Lhs) == len(ts.Rhs) {
+				w.checkValue(e, w.typeOf(ts.Lhs[i]), nil)
+			}
 			w.walkExpr(e)
 		}
 
-		for _, e := range ts.Lhs {
+		var lhsTypes []dst.Expr
+		if ts.Tok == token.DEFINE {
+			lhsTypes = w.assignTypes(len(ts.Lhs), ts.Rhs)
+		}
+		for i, e := range ts.Lhs {
 			if ts.Tok == token.DEFINE {
 				if n := GetIdentDst(e); n != nil {
-					w.scope.add(n.Name, KindVar)
+					w.scope.add(n.Name, KindVar, lhsTypes[i])
 				}
 			}
 			w.walkExpr(e)
@@ -152,7 +235,10 @@ func (w *walker) walkStmt(s dst.Stmt) {
 	case *dst.DeferStmt:
 		w.walkCallExpr(ts.Call)
 	case *dst.ReturnStmt:
-		for _, e := range ts.Results {
+		for i, e := range ts.Results {
+			if len(ts.Results) == len(w.results) {
+				w.checkValue(e, w.results[i], nil)
+			}
 			w.walkExpr(e)
 		}
 	case *dst.BlockStmt:
@@ -218,12 +304,13 @@ func (w *walker) walkStmt(s dst.Stmt) {
 		w.pushScope()
 		w.walkExpr(ts.X)
 		if ts.Tok == token.DEFINE {
+			keyType, valueType := w.rangeTypes(ts.X)
 			if n := GetIdentDst(ts.Key); n != nil {
-				w.scope.add(n.Name, KindVar)
+				w.scope.add(n.Name, KindVar, keyType)
 			}
 
 			if n := GetIdentDst(ts.Value); n != nil {
-				w.scope.add(n.Name, KindVar)
+				w.scope.add(n.Name, KindVar, valueType)
 			}
 		}
 		w.walkExpr(ts.Key)
@@ -264,10 +351,10 @@ func (w *walker) walkDecl(d dst.Decl, phase1 bool) {
 						panic(fmt.Sprintf("strconv.Unquote:%v", err))
 					}
 					name = filepath.Base(str)
-					w.scope.add(name, KindImport)
+					w.scope.add(name, KindImport, nil)
 				} else if s.Name.Name != "_" {
 					name = s.Name.Name
-					w.scope.add(name, KindImport)
+					w.scope.add(name, KindImport, nil)
 				}
 				if !phase1 && name != "" {
 					ident := dst.NewIdent(name)
@@ -282,16 +369,23 @@ func (w *walker) walkDecl(d dst.Decl, phase1 bool) {
 			for _, s := range td.Specs {
 				s := s.(*dst.TypeSpec)
 
-				w.scope.add(s.Name.Name, KindType)
+				w.scope.add(s.Name.Name, KindType, s.Type)
 				if phase1 {
-					return
+					continue
+				}
+				if w.unitf != nil && w.scope.isGlobal() {
+					w.unitf(s)
 				}
 
 				if w.scope.isGlobal() {
 					w.f(s.Name, KindType)
 				}
 
+				// type parameters shadow globals within the declaration
+				w.pushScope()
+				w.walkFieldList(s.TypeParams, KindTypeParam)
 				w.walkExpr(s.Type)
+				w.popScope()
 
 			}
 		case token.CONST, token.VAR:
@@ -308,12 +402,20 @@ func (w *walker) walkDecl(d dst.Decl, phase1 bool) {
 					}
 
 					for _, e := range s.Values {
+						if s.Type != nil {
+							w.checkValue(e, s.Type, nil)
+						}
 						w.walkExpr(e)
 					}
 				}
 
-				for _, n := range s.Names {
-					w.scope.add(n.Name, kind)
+				valueTypes := w.assignTypes(len(s.Names), s.Values)
+				for i, n := range s.Names {
+					typ := s.Type
+					if typ == nil {
+						typ = valueTypes[i]
+					}
+					w.scope.add(n.Name, kind, typ)
 					if !phase1 {
 						if w.scope.isGlobal() {
 							w.f(n, kind)
@@ -324,7 +426,13 @@ func (w *walker) walkDecl(d dst.Decl, phase1 bool) {
 		}
 	case *dst.FuncDecl:
 		if td.Recv == nil {
-			w.scope.add(td.Name.Name, KindFunc)
+			w.scope.add(td.Name.Name, KindFunc, td.Type)
+		} else if phase1 {
+			recv := RecvTypeName(td)
+			if w.methods[recv] == nil {
+				w.methods[recv] = make(map[string]*dst.FuncType)
+			}
+			w.methods[recv][td.Name.Name] = td.Type
 		}
 
 		if !phase1 {
@@ -334,7 +442,10 @@ func (w *walker) walkDecl(d dst.Decl, phase1 bool) {
 				}
 			}
 
+			w.results = fieldTypes(td.Type.Results)
 			w.pushScope()
+			w.walkFieldList(td.Type.TypeParams, KindTypeParam)
+			w.addRecvTypeParams(td)
 			w.walkFieldList(td.Recv, KindReceiver)
 			w.walkFieldList(td.Type.Params, KindParameter)
 			w.walkFieldList(td.Type.Results, KindResult)
@@ -342,6 +453,7 @@ func (w *walker) walkDecl(d dst.Decl, phase1 bool) {
 				w.walkBlockStmt(td.Body)
 			}
 			w.popScope()
+			w.results = nil
 		}
 	}
 }
@@ -353,12 +465,16 @@ func (w *walker) walkDecl(d dst.Decl, phase1 bool) {
 // Stmt包含Expr，一切都是Node
 func (w *walker) walkFile(phase1 bool) {
 	for _, d := range w.df.Decls {
+		if gd, ok := d.(*dst.GenDecl); !phase1 && w.unitf != nil && !(ok && gd.Tok == token.TYPE) {
+			w.unitf(d)
+		}
 		w.walkDecl(d, phase1)
 	}
 }
 
 func (w *walker) walk() {
 	w.pushScope()
+	w.methods = make(map[string]map[string]*dst.FuncType)
 
 	w.walkFile(true)
 
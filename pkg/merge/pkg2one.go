@@ -30,9 +30,39 @@ func PackageFiles(inFiles []string) (output string, err error) {
 		return
 	}
 
+	mdf, _, err := PackageFilesDst(token.NewFileSet(), inFiles)
+	if err != nil {
+		return
+	}
+
+	// dst -> ast
+	fset, mf, err := decorator.RestoreFile(mdf)
+	if err != nil {
+		logger.Instance().Error("RestoreFile", zap.Error(err))
+		return
+	}
+
+	// Write the output file.
+	var buf bytes.Buffer
+	if err = format.Node(&buf, fset, mf); err != nil {
+		logger.Instance().Error("format.Node", zap.Error(err))
+		return
+	}
+
+	output = buf.String()
+	return
+}
+
+// PackageFilesDst is like PackageFiles, but returns the merged dst.File,
+// along with the mapping from its nodes to the nodes of input files parsed with fset.
+func PackageFilesDst(fset *token.FileSet, inFiles []string) (mdf *dst.File, nodes map[dst.Node]ast.Node, err error) {
+	if len(inFiles) == 0 {
+		return
+	}
+
 	// collect all files as dst.File
 	files := make([]*dst.File, 0, len(inFiles))
-	fset := token.NewFileSet()
+	nodes = make(map[dst.Node]ast.Node)
 	var name string
 	for _, fname := range inFiles {
 		var (
@@ -45,11 +75,15 @@ func PackageFiles(inFiles []string) (output string, err error) {
 			return
 		}
 
-		df, err = decorator.DecorateFile(fset, f)
+		dec := decorator.NewDecorator(fset)
+		df, err = dec.DecorateFile(f)
 		if err != nil {
 			logger.Instance().Error("DecorateFile", zap.Error(err))
 			return
 		}
+		for dn, an := range dec.Ast.Nodes {
+			nodes[dn] = an
+		}
 		files = append(files, df)
 		if name == "" {
 			name = df.Name.Name
@@ -211,22 +245,6 @@ func PackageFiles(inFiles []string) (output string, err error) {
 	decls = append(decls, importDecl)
 	decls = append(decls, nonimportDecls...)
 
-	mdf := &dst.File{Name: files[0].Name, Decs: files[0].Decs, Decls: decls}
-
-	// dst -> ast
-	var mf *ast.File
-	fset, mf, err = decorator.RestoreFile(mdf)
-	if err != nil {
-		logger.Instance().Error("RestoreFile", zap.Error(err))
-	}
-
-	// Write the output file.
-	var buf bytes.Buffer
-	if err = format.Node(&buf, fset, mf); err != nil {
-		logger.Instance().Error("format.Node", zap.Error(err))
-		return
-	}
-
-	output = buf.String()
+	mdf = &dst.File{Name: files[0].Name, Decs: files[0].Decs, Decls: decls}
 	return
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dave/dst"
+
+	"github.com/zhiqiangxu/gg/pkg/globals"
+)
+
+var (
+	// ErrKeep when a global to keep is not declared by the template
+	ErrKeep = errors.New("no such global to keep")
+)
+
+// prune removes the declarations not reachable from inst.Keep, or from the exported globals
+// if only -prune is given, along with the imports no longer used, and reports what was pruned.
+// Declarations of the test files, and those like `var _ I = T{}`, are kept if all they refer to is kept.
+func prune(inst *instance, df *dst.File, templatePos func(dst.Node) token.Position) (err error) {
+	if !inst.Prune && len(inst.Keep) == 0 {
+		return
+	}
+
+	units := globals.Units(df)
+	declared := make(map[string]bool)
+	for _, u := range units {
+		for _, name := range u.Names {
+			declared[name] = true
+		}
+	}
+
+	// init functions always run, so they're kept with what they refer to
+	roots := map[string]bool{"init": true}
+	if len(inst.Keep) == 0 {
+		for name := range declared {
+			if ast.IsExported(name) {
+				roots[name] = true
+			}
+		}
+		if df.Name.Name == "main" {
+			roots["main"] = true
+		}
+	}
+	var unknown []string
+	for _, name := range inst.Keep {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+		roots[name] = true
+	}
+	if len(unknown) > 0 {
+		err = fmt.Errorf("%v: %s", ErrKeep, strings.Join(unknown, ", "))
+		return
+	}
+
+	tests := make(map[string]bool)
+	for _, input := range inst.testInputs {
+		tests[input] = true
+	}
+	reached := globals.Reachable(units, roots, func(u *globals.Unit) bool {
+		if tests[templatePos(u.Node).Filename] {
+			return true
+		}
+		for _, name := range u.Names {
+			if name != "_" {
+				return false
+			}
+		}
+		return len(u.Names) > 0
+	})
+
+	nodes := make(map[dst.Node]bool)
+	var pruned []string
+	for _, u := range units {
+		if reached[u] {
+			continue
+		}
+		nodes[u.Node] = true
+		if fd, ok := u.Node.(*dst.FuncDecl); ok && u.Recv != "" {
+			pruned = append(pruned, u.Recv+"."+fd.Name.Name)
+		} else {
+			pruned = append(pruned, u.Names...)
+		}
+	}
+	globals.RemoveNodes(df, nodes)
+	imports := globals.RemoveUnusedImports(df)
+
+	if inst.silent {
+		return
+	}
+	if len(pruned) > 0 {
+		sort.Strings(pruned)
+		fmt.Fprintf(os.Stderr, "pruned %s\n", strings.Join(pruned, ", "))
+	}
+	if len(imports) > 0 {
+		sort.Strings(imports)
+		fmt.Fprintf(os.Stderr, "pruned imports %s\n", strings.Join(imports, ", "))
+	}
+	return
+}
+
+// splitList splits a comma separated list, ignoring empty elements
+func splitList(s string) (list []string) {
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return
+}
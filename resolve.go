@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"os"
+	"os/exec"
+	pathpkg "path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrImportNotFound when no package is found for a qualifier of a replacement type
+	ErrImportNotFound = errors.New("no package found")
+	// ErrAmbiguousImport when more than one package is found for a qualifier of a replacement type
+	ErrAmbiguousImport = errors.New("ambiguous import")
+)
+
+// inferImports resolves the qualifiers of replacement types not imported by the template nor
+// given by -import, e.g. time for -t T=time.Duration. The packages are searched for in the standard
+// library, then in the current module, then in the modules it requires which are in the module cache.
+// It returns inst itself if nothing is inferred, otherwise a copy with the inferred imports.
+func inferImports(inst *instance, importMap map[string]string) (*instance, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, target := range inst.Types {
+		expr, err := parser.ParseExpr(target)
+		if err != nil {
+			// reported by checkParams
+			continue
+		}
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if se, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := se.X.(*ast.Ident); ok && !seen[id.Name] {
+					seen[id.Name] = true
+					if importMap[id.Name] == "" && inst.Imports[id.Name] == "" {
+						names = append(names, id.Name)
+					}
+				}
+			}
+			return true
+		})
+	}
+	if len(names) == 0 {
+		return inst, nil
+	}
+	sort.Strings(names)
+
+	ctx := buildContext(inst)
+	roots := []pkgRoot{{dir: filepath.Join(ctx.GOROOT, "src"), std: true}}
+	roots = append(roots, moduleRoots(outputDir(inst))...)
+
+	imports := make(map[string]string, len(inst.Imports)+len(names))
+	for name, path := range inst.Imports {
+		imports[name] = path
+	}
+	for _, name := range names {
+		path, err := findImport(&ctx, roots, name)
+		if err != nil {
+			return nil, err
+		}
+		imports[name] = path
+	}
+
+	one := *inst
+	one.Imports = imports
+	return &one, nil
+}
+
+// pkgRoot is a directory of packages whose import paths are prefixed with path,
+// those of the same tier are searched together, i.e., the standard library, the current module, or its requirements
+type pkgRoot struct {
+	dir  string
+	path string
+	std  bool
+	main bool
+}
+
+// findImport returns the import path of the package named name, the standard library
+// is searched first, then the current module, then its requirements
+func findImport(ctx *build.Context, roots []pkgRoot, name string) (path string, err error) {
+	tier := func(r pkgRoot) int {
+		switch {
+		case r.std:
+			return 0
+		case r.main:
+			return 1
+		}
+		return 2
+	}
+	for t := 0; t <= 2; t++ {
+		var candidates []string
+		for _, r := range roots {
+			if tier(r) == t {
+				candidates = append(candidates, findPackages(ctx, r, name)...)
+			}
+		}
+		switch len(candidates) {
+		case 0:
+			continue
+		case 1:
+			return candidates[0], nil
+		default:
+			sort.Strings(candidates)
+			err = fmt.Errorf("%v %s: %s, use -import %s=path", ErrAmbiguousImport, name, strings.Join(candidates, ", "), name)
+			return
+		}
+	}
+	err = fmt.Errorf("%v for %s, use -import %s=path", ErrImportNotFound, name, name)
+	return
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// findPackages returns the import paths of packages named name under r, only directories
+// named after the package, e.g. name, name.v2, go-name or name/v2, are considered
+func findPackages(ctx *build.Context, r pkgRoot, name string) (paths []string) {
+	filepath.Walk(r.dir, func(dir string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		base := info.Name()
+		if dir != r.dir && (base == "testdata" || base == "vendor" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_") ||
+			(base == "internal" && !r.main) || (r.std && base == "cmd" && filepath.Dir(dir) == r.dir)) {
+			return filepath.SkipDir
+		}
+		// nested modules are separate roots, if required at all
+		if dir != r.dir && !r.std {
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		if dir == r.dir && r.path != "" {
+			// the module root is named after the module path, the directory has the version
+			base = pathpkg.Base(r.path)
+			if majorVersion.MatchString(base) {
+				base = pathpkg.Base(pathpkg.Dir(r.path))
+			}
+		} else if majorVersion.MatchString(base) {
+			base = filepath.Base(filepath.Dir(dir))
+		}
+		if base != name && !strings.HasPrefix(base, name+".") && strings.TrimPrefix(base, "go-") != name {
+			return nil
+		}
+		bp, err := ctx.ImportDir(dir, 0)
+		if err != nil || bp.Name != name {
+			return nil
+		}
+		rel, err := filepath.Rel(r.dir, dir)
+		if err != nil {
+			return nil
+		}
+		path := filepath.ToSlash(rel)
+		switch {
+		case rel == ".":
+			path = r.path
+		case r.path != "":
+			path = r.path + "/" + path
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	return
+}
+
+// moduleRoots returns the current module of dir and the modules it requires which are in the module cache,
+// nothing if dir is not in a module
+func moduleRoots(dir string) (roots []pkgRoot) {
+	// go.sum of the module is left alone
+	cmd := exec.Command("go", "list", "-e", "-mod=readonly", "-m", "-f", "{{.Main}}\t{{.Path}}\t{{.Dir}}", "all")
+	cmd.Dir = dir
+	// offline, only what is in the module cache
+	cmd.Env = append(os.Environ(), "GOPROXY=off")
+	out, err := cmd.Output()
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[2] == "" {
+			continue
+		}
+		roots = append(roots, pkgRoot{dir: fields[2], path: fields[1], main: fields[0] == "true"})
+	}
+	return
+}
+
+// outputDir returns the directory the output goes to, whose module the imports are searched in
+func outputDir(inst *instance) string {
+	if inst.Output == "" {
+		return "."
+	}
+	dir := filepath.Dir(inst.Output)
+	if _, err := os.Stat(dir); err != nil {
+		return "."
+	}
+	return dir
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	// runPrefix is the prefix of run lines in doc comments, e.g. `// run: gg -i set.go -t Type=string`
+	runPrefix = "run:"
+	// runDirective is the directive form, e.g. `//gg:run -i set.go -t Type=string`
+	runDirective = "//gg:run"
+)
+
+// directive is a gg invocation embedded in a go file
+type directive struct {
+	// Pos is where the directive is found
+	Pos token.Position
+	// Args for gg, excluding gg itself
+	Args []string
+}
+
+// runCommand implements `gg run [-n] [dir...]`, which executes the directives
+// found in go files relative to their directories. dir/... scans recursively.
+func runCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	dryRun := fs.Bool("n", false, "dry run, only list the directives")
+	checkStale := fs.Bool("check", false, "pass -check to each directive, i.e., report stale outputs instead of writing")
+	showDiff := fs.Bool("diff", false, "pass -diff to each directive, i.e., print diffs instead of writing")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s run [options] [dir|dir/...]...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	directives, err := findDirectives(patterns)
+	if err != nil {
+		return
+	}
+
+	if *dryRun {
+		for _, d := range directives {
+			fmt.Printf("%s: (cd %s && gg %s)\n", d.Pos, filepath.Dir(d.Pos.Filename), strings.Join(d.Args, " "))
+		}
+		return
+	}
+
+	var extra []string
+	if *checkStale {
+		extra = append(extra, "-check")
+	}
+	if *showDiff {
+		extra = append(extra, "-diff")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return
+	}
+	var failed []string
+	for _, d := range directives {
+		cmd := exec.Command(self, append(extra, d.Args...)...)
+		cmd.Dir = filepath.Dir(d.Pos.Filename)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", d.Pos, err))
+		}
+	}
+	if len(failed) > 0 {
+		err = fmt.Errorf("failed directives: %s", strings.Join(failed, "; "))
+	}
+	return
+}
+
+// findDirectives scans go files in the directories matching patterns for directives
+func findDirectives(patterns []string) (directives []directive, err error) {
+	files, err := goFiles(patterns)
+	if err != nil {
+		return
+	}
+
+	fset := token.NewFileSet()
+	for _, file := range files {
+		var ds []directive
+		ds, err = fileDirectives(fset, file)
+		if err != nil {
+			return
+		}
+		directives = append(directives, ds...)
+	}
+	return
+}
+
+// goFiles returns the go files in the directories matching patterns, dir/... matches recursively
+func goFiles(patterns []string) (files []string, err error) {
+	var dirs []string
+	for _, pattern := range patterns {
+		if !strings.HasSuffix(pattern, "/...") {
+			dirs = append(dirs, pattern)
+			continue
+		}
+		root := strings.TrimSuffix(pattern, "/...")
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				name := info.Name()
+				// the root is scanned even if named like .. or _dir
+				if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor") {
+					return filepath.SkipDir
+				}
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	for _, dir := range dirs {
+		var infos []os.FileInfo
+		infos, err = ioutil.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, info := range infos {
+			if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") {
+				continue
+			}
+			files = append(files, filepath.Join(dir, info.Name()))
+		}
+	}
+	return
+}
+
+// fileDirectives returns the directives in comments of a go file
+func fileDirectives(fset *token.FileSet, path string) (directives []directive, err error) {
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return
+	}
+
+	// directives copied from the template into gg output are not ours
+	if len(f.Comments) > 0 && f.Comments[0].List[0].Text == generatedLine {
+		return
+	}
+
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			var line string
+			switch {
+			case strings.HasPrefix(c.Text, runDirective+" "):
+				line = strings.TrimPrefix(c.Text, runDirective)
+			case strings.HasPrefix(c.Text, "//"):
+				line = strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+				if !strings.HasPrefix(line, runPrefix) {
+					continue
+				}
+				line = strings.TrimPrefix(line, runPrefix)
+			default:
+				continue
+			}
+
+			args := splitArgs(line)
+			if len(args) > 0 && args[0] == "gg" {
+				args = args[1:]
+			} else if !strings.HasPrefix(c.Text, runDirective) {
+				// run: for other commands
+				continue
+			}
+			directives = append(directives, directive{Pos: fset.Position(c.Pos()), Args: args})
+		}
+	}
+	return
+}
+
+// splitArgs splits a command line into arguments, single and double quotes are honoured
+func splitArgs(line string) (args []string) {
+	var (
+		arg   strings.Builder
+		quote rune
+		inArg bool
+	)
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return
+}
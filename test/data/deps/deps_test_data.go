@@ -0,0 +1,35 @@
+package deps
+
+// Key for key type
+type Key string
+
+// Value for value type
+type Value int
+
+type (
+	empty struct{}
+	pair  struct {
+		k Key
+		v Value
+	}
+)
+
+const size = 8
+
+var keys = map[Key]empty{}
+
+// Map maps Key to Value
+type Map []pair
+
+// Get returns the value of k
+func (m Map) Get(k Key) (v Value) {
+	return
+}
+
+func newEmpty() empty {
+	return empty{}
+}
+
+func values(m Map) []Value {
+	return nil
+}
@@ -0,0 +1,36 @@
+package deps
+
+import "strings"
+
+// List is a list of Node
+type List struct {
+	head *Node
+}
+
+// Node is an element of List
+type Node struct {
+	next *Node
+	name string
+}
+
+// Names returns the names joined by sep
+func (l *List) Names(sep string) string {
+	var names []string
+	for n := l.head; n != nil; n = n.next {
+		names = append(names, format(n))
+	}
+	return strings.Join(names, sep)
+}
+
+func format(n *Node) string {
+	return n.name
+}
+
+// Tree is not used by List
+type Tree struct {
+	root *Node
+}
+
+var _ = &List{}
+
+var _ = &Tree{}
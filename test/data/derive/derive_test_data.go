@@ -0,0 +1,27 @@
+package derive
+
+// Something will be replaced
+type Something interface{}
+
+// SomethingQueue is a queue.
+type SomethingQueue struct {
+	items []Something
+	head  *somethingNode
+}
+
+type somethingNode struct {
+	next *somethingNode
+}
+
+// NewSomethingQueue is ctor for SomethingQueue
+func NewSomethingQueue() *SomethingQueue {
+	return &SomethingQueue{}
+}
+
+// PushSomething adds item to the queue
+func (q *SomethingQueue) PushSomething(item Something) {
+	q.items = append(q.items, item)
+}
+
+// Somethings is not a camel-case word match
+var Somethings int
@@ -0,0 +1,17 @@
+package derive
+
+// Key and KeyValue overlap in derived names
+type (
+	Key      interface{}
+	KeyValue interface{}
+)
+
+// KeyValueMap maps keys to values
+type KeyValueMap map[Key]KeyValue
+
+// KeyList lists keys
+type KeyList []Key
+
+type keyValueNode struct {
+	kv KeyValue
+}
@@ -0,0 +1,30 @@
+package embedded
+
+// Base is embedded by value
+type Base struct {
+	ID int
+}
+
+// Node is embedded by pointer
+type Node struct {
+	Next *Node
+}
+
+// Name is embedded along with a field taking its new name
+type Name string
+
+// Outer embeds all of them
+type Outer struct {
+	Base
+	*Node
+	Name
+	Label string
+}
+
+func newOuter() Outer {
+	o := Outer{Base: Base{ID: 1}, Node: new(Node), Name: "outer"}
+	_ = o.Base.ID
+	_ = o.Node.Next
+	_ = o.Name
+	return o
+}
@@ -0,0 +1,40 @@
+package generic
+
+// Key for key type
+type Key interface{}
+
+// Value for value type
+type Value int
+
+type empty struct{}
+
+// Map maps Key to Value
+type Map map[Key]Value
+
+// Max returns the largest value
+func (m Map) Max() (max Value) {
+	for _, v := range m {
+		if v > max {
+			max = v
+		}
+	}
+	return
+}
+
+// Keys returns the keys of m
+func Keys(m Map) map[Key]empty {
+	keys := make(map[Key]empty, len(m))
+	for k := range m {
+		keys[k] = empty{}
+	}
+	return keys
+}
+
+var defaultMap = Map{}
+
+func first(keys []Key) Key {
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys[0]
+}
@@ -0,0 +1,29 @@
+package generic
+
+// Stack of T
+type Stack[T any] struct {
+	items []T
+}
+
+// Push pushes v
+func (s *Stack[E]) Push(v E) {
+	s.items = append(s.items, v)
+}
+
+// Top returns the top items
+func (s *Stack[T]) Top(n int) Pair[T, int] {
+	return MakePair(s.items[len(s.items)-1], n)
+}
+
+// Pair of values
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// MakePair makes a Pair
+func MakePair[A, B any](a A, b B) Pair[A, B] {
+	return Pair[A, B]{First: a, Second: b}
+}
+
+var strings Stack[string]
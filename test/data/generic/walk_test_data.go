@@ -0,0 +1,38 @@
+package generic
+
+// T is shadowed by type parameters
+type T struct{}
+
+// Number is a constraint
+type Number interface {
+	~int | ~float64
+}
+
+// Sum of values
+func Sum[T Number](values ...T) (sum T) {
+	for _, v := range values {
+		sum += v
+	}
+	return
+}
+
+// Box holds a value
+type Box[T any] struct {
+	v T
+}
+
+// Get returns the value
+func (b Box[T]) Get() T {
+	return b.v
+}
+
+// Holder holds a T
+type Holder struct {
+	t   T
+	box Box[T]
+	sum func(...int) int
+}
+
+func newHolder() Holder {
+	return Holder{box: Box[T]{v: T{}}, sum: Sum[int]}
+}
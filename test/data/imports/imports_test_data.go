@@ -0,0 +1,23 @@
+package imports
+
+import (
+	"github.com/dave/dst"
+	"unsafe"
+)
+
+import fmt1 "fmt"
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+// Item is replaced
+type Item unsafe.Pointer
+
+// Describe describes an Item
+func Describe(i Item, n *dst.Ident) string {
+	fmt1.Println(n.Name)
+	return strings.TrimSpace(fmt.Sprint(i))
+}
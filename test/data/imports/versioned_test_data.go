@@ -0,0 +1,20 @@
+//go:build go1.22
+
+package imports
+
+import (
+	"math/rand/v2"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Roll marshals a random number
+func Roll() ([]byte, error) {
+	return yaml.Marshal(rand.IntN(6))
+}
+
+// Trim trims s
+func Trim(s string) string {
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,14 @@
+package literal
+
+// DT for data type
+type DT float64
+
+var data = []DT{1, -129, 300, 1.5, 'a'}
+
+func get() DT {
+	return -1
+}
+
+func is(v DT) bool {
+	return v == 2
+}
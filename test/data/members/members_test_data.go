@@ -0,0 +1,54 @@
+package members
+
+// Linker is implemented by Entry
+type Linker interface {
+	Next() *Entry
+}
+
+// Entry is an element of List
+type Entry struct {
+	next  *Entry
+	Value int
+}
+
+// Next returns the entry after e
+func (e *Entry) Next() *Entry {
+	return e.next
+}
+
+// List is a linked list
+type List struct {
+	head *Entry
+}
+
+// PushFront inserts v at the front of l
+func (l *List) PushFront(v int) *Entry {
+	l.head = &Entry{next: l.head, Value: v}
+	return l.head
+}
+
+// Queue has a PushFront unrelated to List
+type Queue struct {
+	items []int
+}
+
+// PushFront inserts v at the front of q
+func (q *Queue) PushFront(v int) {
+	q.items = append([]int{v}, q.items...)
+}
+
+// node has a next unrelated to Entry
+type node struct {
+	next *node
+}
+
+func use(l *List, q *Queue, n *node, link Linker) {
+	push := l.PushFront
+	pushExpr := (*List).PushFront
+	push(1)
+	pushExpr(l, 2)
+	q.PushFront(3)
+	_ = link.Next()
+	_ = n.next
+	_ = l.head.next.Next()
+}
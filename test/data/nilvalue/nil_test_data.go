@@ -0,0 +1,44 @@
+package nilvalue
+
+// ValueType will be replaced
+type ValueType interface{}
+
+type node struct {
+	next *node
+	val  ValueType
+}
+
+// Pop returns nil for empty node
+func Pop(n *node) ValueType {
+	if n.next == nil {
+		return nil
+	}
+	next := n.next
+	v := next.val
+	next.val = nil
+	return v
+}
+
+// IsNil compares with nil
+func IsNil(v ValueType) bool {
+	return v == nil
+}
+
+// NewNode creates an empty node
+func NewNode() *node {
+	return &node{next: nil, val: nil}
+}
+
+type box struct {
+	v ValueType
+}
+
+// Boxes elides the types of inner literals
+func Boxes() []box {
+	return []box{{v: nil}, {nil}}
+}
+
+// Send sends nil
+func Send(ch chan ValueType) {
+	ch <- nil
+}
@@ -0,0 +1,8 @@
+package paren
+
+// Value is replaced
+type Value interface{ String() string }
+
+func convert(x interface{ String() string }) (Value, func(Value) string) {
+	return Value(x), Value.String
+}
@@ -1,15 +1,21 @@
 package test
 
 import (
+	"bytes"
 	"go/parser"
 	"go/token"
 	"testing"
 
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/dave/dst"
 	"github.com/dave/dst/decorator"
 
+	"github.com/zhiqiangxu/gg/pkg/check"
+	"github.com/zhiqiangxu/gg/pkg/diff"
+	"github.com/zhiqiangxu/gg/pkg/generic"
 	"github.com/zhiqiangxu/gg/pkg/globals"
 	"github.com/zhiqiangxu/gg/pkg/merge"
 )
@@ -59,3 +65,752 @@ func TestMerge(t *testing.T) {
 	// ioutil.WriteFile("merged.go", []byte(output), 0644)
 
 }
+
+func TestDeriveNames(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/derive/derive_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	derived, methods, err := globals.DeriveNames(df, map[string]string{"Something": "pkg.Item"}, nil)
+	if err != nil {
+		t.Fatal("DeriveNames", err)
+	}
+
+	expect := map[string]string{
+		"SomethingQueue":    "ItemQueue",
+		"somethingNode":     "itemNode",
+		"NewSomethingQueue": "NewItemQueue",
+	}
+	if !reflect.DeepEqual(expect, derived) {
+		t.Fatal("expect != derived", derived)
+	}
+	if !reflect.DeepEqual(map[string]string{"SomethingQueue.PushSomething": "PushItem"}, methods) {
+		t.Fatal("unexpected methods", methods)
+	}
+
+	_, _, err = globals.DeriveNames(df, map[string]string{"Something": "string"}, map[string]string{"Somethings": "StringQueue"})
+	if err == nil {
+		t.Fatal("collision not reported")
+	}
+}
+
+func TestDeriveOverlappingNames(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/derive/overlap_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	expect := map[string]string{
+		"KeyValueMap":  "IntMap",
+		"KeyList":      "StringList",
+		"keyValueNode": "intNode",
+	}
+	// the longer name wins whatever the map order is
+	for i := 0; i < 20; i++ {
+		derived, _, err := globals.DeriveNames(df, map[string]string{"Key": "string", "KeyValue": "int"}, nil)
+		if err != nil {
+			t.Fatal("DeriveNames", err)
+		}
+		if !reflect.DeepEqual(expect, derived) {
+			t.Fatal("expect != derived", derived)
+		}
+	}
+}
+
+func TestFindNil(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/nilvalue/nil_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	uses := globals.FindNil(df, []string{"ValueType"})
+	// return nil, next.val = nil, v == nil, val: nil, {v: nil}, {nil}, ch <- nil
+	if len(uses) != 7 {
+		t.Fatal("unexpected uses", len(uses))
+	}
+	cmps := 0
+	for _, use := range uses {
+		if use.Cmp != nil {
+			cmps++
+		}
+	}
+	if cmps != 1 {
+		t.Fatal("unexpected comparisons", cmps)
+	}
+
+	if globals.Nilable(df, "int", nil) || !globals.Nilable(df, "*int", nil) || !globals.Nilable(df, "ValueType", nil) || globals.Nilable(df, "node", nil) {
+		t.Fatal("Nilable wrong")
+	}
+	imports := map[string]string{"time": "time", "bytes": "bytes"}
+	if globals.Nilable(df, "time.Duration", imports) || globals.Nilable(df, "bytes.Buffer", imports) || !globals.Nilable(df, "*bytes.Buffer", imports) {
+		t.Fatal("Nilable wrong for qualified types")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "../example/sort/kofn.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	dec := decorator.NewDecorator(fset)
+	df, err := dec.DecorateFile(f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	globals.RenameDecl(df, func(ident *dst.Ident, kind globals.SymKind) {
+		if ident.Name == "DT" {
+			ident.Name = "bool"
+		}
+	})
+	globals.RemoveDecl(df, []string{"bool"})
+
+	errs, err := check.File(df, "", func(n dst.Node) token.Position {
+		if an, ok := dec.Ast.Nodes[n]; ok {
+			return fset.Position(an.Pos())
+		}
+		return token.Position{}
+	})
+	if err != nil {
+		t.Fatal("check.File", err)
+	}
+	// < and > on bool
+	if len(errs) != 6 {
+		t.Fatal("unexpected errors", errs)
+	}
+	for _, e := range errs {
+		if e.Template.Filename != "../example/sort/kofn.go" || !e.Generated.IsValid() {
+			t.Fatal("wrong positions", e)
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "../example/number/comparable/unsigned.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	expect := map[string][]string{
+		"SignedType":   {"signed", "samesize UnsignedType"},
+		"UnsignedType": {"unsigned"},
+	}
+	if !reflect.DeepEqual(expect, check.ConstraintsOf(df)) {
+		t.Fatal("unexpected constraints", check.ConstraintsOf(df))
+	}
+
+	if err = check.Constraints(df, map[string]string{"SignedType": "int32", "UnsignedType": "uint32"}, nil); err != nil {
+		t.Fatal("Constraints", err)
+	}
+	if err = check.Constraints(df, map[string]string{"SignedType": "int32", "UnsignedType": "uint64"}, nil); err == nil {
+		t.Fatal("samesize not checked")
+	}
+	if err = check.Constraints(df, map[string]string{"SignedType": "float64"}, nil); err == nil {
+		t.Fatal("signed not checked")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n")
+	new := []byte("a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n")
+
+	expect := `--- old
++++ new
+@@ -2,9 +2,10 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
+ j
++k
+`
+	if got := diff.Unified("old", "new", old, new); got != expect {
+		t.Fatal("unexpected diff", got)
+	}
+	if diff.Unified("old", "new", old, old) != "" {
+		t.Fatal("diff for equal content")
+	}
+}
+
+func TestRemoveUnusedImports(t *testing.T) {
+	df, _, err := merge.PackageFilesDst(token.NewFileSet(), []string{"data/merge/f1.go", "data/merge/f2.go"})
+	if err != nil {
+		t.Fatal("PackageFilesDst", err)
+	}
+
+	// drop hello, which is the only user of fmt and math
+	var decls []dst.Decl
+	for _, d := range df.Decls {
+		if fd, ok := d.(*dst.FuncDecl); ok && fd.Name.Name == "hello" {
+			continue
+		}
+		decls = append(decls, d)
+	}
+	df.Decls = decls
+
+	removed := globals.RemoveUnusedImports(df)
+	sort.Strings(removed)
+	if !reflect.DeepEqual(removed, []string{"fmt", "math"}) {
+		t.Fatal("unexpected removed imports", removed)
+	}
+	if imports := globals.GetImportMapDst(df); len(imports) != 1 || imports["fmt1"] != "fmt" {
+		t.Fatal("unexpected imports left", imports)
+	}
+
+	// package names differing from the last element of the path
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/imports/versioned_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+	df, err = decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+	decls = nil
+	for _, d := range df.Decls {
+		if fd, ok := d.(*dst.FuncDecl); ok && fd.Name.Name == "Trim" {
+			continue
+		}
+		decls = append(decls, d)
+	}
+	df.Decls = decls
+
+	removed = globals.RemoveUnusedImports(df)
+	if !reflect.DeepEqual(removed, []string{"strings"}) {
+		t.Fatal("unexpected removed imports", removed)
+	}
+	if imports := globals.GetImportMapDst(df); len(imports) != 2 {
+		t.Fatal("unexpected imports left", imports)
+	}
+}
+
+func TestOrganizeImports(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/imports/imports_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	specs := globals.TypeSpecs(df, []string{"Item"})
+	globals.RenameDecl(df, func(ident *dst.Ident, kind globals.SymKind) {
+		if ident.Name == "Item" {
+			ident.Name = "*list.List"
+		}
+	})
+	globals.RemoveNodes(df, map[dst.Node]bool{specs[0]: true})
+	globals.AddImports(df, map[string]string{"list": "container/list", "fmt2": "fmt"})
+
+	removed := globals.OrganizeImports(df)
+	if !reflect.DeepEqual(removed, []string{"unsafe"}) {
+		t.Fatal("unexpected removed imports", removed)
+	}
+
+	var buf bytes.Buffer
+	if err = decorator.Fprint(&buf, df); err != nil {
+		t.Fatal("Fprint", err)
+	}
+	out := buf.String()
+	want := "import (\n\t\"container/list\"\n\t_ \"embed\"\n\t\"fmt\"\n\t\"strings\"\n\n\t\"github.com/dave/dst\"\n)\n"
+	if !strings.Contains(out, want) || strings.Count(out, "\nimport") != 1 {
+		t.Fatal("unexpected imports", out)
+	}
+	if !strings.Contains(out, "fmt.Println(n.Name)") || !strings.Contains(out, "func Describe(i *list.List, n *dst.Ident)") {
+		t.Fatal("references not updated", out)
+	}
+
+	// package names differing from the last element of the path
+	f, err = parser.ParseFile(fset, "data/imports/versioned_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+	df, err = decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+	var decls []dst.Decl
+	for _, d := range df.Decls {
+		if fd, ok := d.(*dst.FuncDecl); ok && fd.Name.Name == "Trim" {
+			continue
+		}
+		decls = append(decls, d)
+	}
+	df.Decls = decls
+	globals.AddImports(df, map[string]string{"yaml": "gopkg.in/yaml.v2"})
+
+	removed = globals.OrganizeImports(df)
+	if !reflect.DeepEqual(removed, []string{"strings"}) {
+		t.Fatal("unexpected removed imports", removed)
+	}
+	buf.Reset()
+	if err = decorator.Fprint(&buf, df); err != nil {
+		t.Fatal("Fprint", err)
+	}
+	out = buf.String()
+	want = "import (\n\t\"math/rand/v2\"\n\n\t\"gopkg.in/yaml.v2\"\n)\n"
+	if !strings.Contains(out, want) || !strings.Contains(out, "yaml.Marshal(rand.IntN(6))") {
+		t.Fatal("unexpected imports", out)
+	}
+}
+
+func TestParenthesizeTypes(t *testing.T) {
+	for target, want := range map[string]string{
+		"*pkg.Node":       "return (*pkg.Node)(x), (*pkg.Node).String",
+		"<-chan int":      "return (<-chan int)(x), (<-chan int).String",
+		"func()":          "return (func())(x), (func()).String",
+		"func() error":    "return func() error(x), (func() error).String",
+		"[]byte":          "return []byte(x), ([]byte).String",
+		"pkg.List[int]":   "return pkg.List[int](x), pkg.List[int].String",
+		"map[string]bool": "return map[string]bool(x), (map[string]bool).String",
+	} {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "data/paren/paren_test_data.go", nil, parser.ParseComments)
+		if err != nil {
+			t.Fatal("ParseFile", err)
+		}
+		df, err := decorator.DecorateFile(fset, f)
+		if err != nil {
+			t.Fatal("DecorateFile", err)
+		}
+
+		globals.RenameDecl(df, func(ident *dst.Ident, kind globals.SymKind) {
+			if ident.Name == "Value" {
+				ident.Name = target
+			}
+		})
+		globals.ParenthesizeTypes(df)
+
+		var buf bytes.Buffer
+		if err = decorator.Fprint(&buf, df); err != nil {
+			t.Fatal("Fprint", err)
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Fatal("missing from output", want, buf.String())
+		}
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/literal/literal_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	cases := map[string][]string{
+		"int8":    {"-129", "300", "1.5"},
+		"uint8":   {"-129", "300", "1.5", "-1"},
+		"float64": nil,
+		"string":  {"1", "-129", "300", "1.5", "'a'", "-1", "2"},
+	}
+	for target, expect := range cases {
+		lits, err := check.Literals(df, map[string]string{"DT": target}, nil)
+		if err != nil {
+			t.Fatal("Literals", err)
+		}
+		var got []string
+		for _, lit := range lits {
+			got = append(got, lit.Value)
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Fatal("unexpected literals for", target, got)
+		}
+	}
+}
+
+func TestDependents(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/deps/deps_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	units := globals.Units(df)
+	names := func(seeds ...string) (got []string) {
+		m := make(map[string]bool)
+		for _, seed := range seeds {
+			m[seed] = true
+		}
+		for u := range globals.Dependents(units, m) {
+			if u.Recv != "" {
+				got = append(got, u.Recv+".method")
+			}
+			got = append(got, u.Names...)
+		}
+		sort.Strings(got)
+		return
+	}
+
+	if got := names("Key"); !reflect.DeepEqual(got, []string{"Key", "Map", "Map.method", "keys", "pair", "values"}) {
+		t.Fatal("unexpected dependents of Key", got)
+	}
+	if got := names("Value"); !reflect.DeepEqual(got, []string{"Map", "Map.method", "Value", "pair", "values"}) {
+		t.Fatal("unexpected dependents of Value", got)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/deps/reach_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	units := globals.Units(df)
+	blank := func(u *globals.Unit) bool {
+		return len(u.Names) == 1 && u.Names[0] == "_"
+	}
+	var got []string
+	for u, ok := range globals.Reachable(units, map[string]bool{"List": true}, blank) {
+		if !ok {
+			continue
+		}
+		if u.Recv != "" {
+			got = append(got, u.Recv+".method")
+		}
+		got = append(got, u.Names...)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"List", "List.method", "Node", "_", "format"}) {
+		t.Fatal("unexpected reachable units", got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/generic/generic_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	problems, err := generic.Convert(df, []generic.Param{{Placeholder: "Key", Name: "K"}, {Placeholder: "Value", Name: "V"}})
+	if err != nil {
+		t.Fatal("Convert", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0].Msg, "defaultMap") {
+		t.Fatal("unexpected problems", problems)
+	}
+
+	var buf bytes.Buffer
+	if err = decorator.Fprint(&buf, df); err != nil {
+		t.Fatal("Fprint", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"type Map[K comparable, V cmp.Ordered] map[K]V",
+		"func (m Map[K, V]) Max() (max V)",
+		"func Keys[K comparable, V cmp.Ordered](m Map[K, V]) map[K]empty",
+		"func first[K comparable](keys []K) K",
+		"return *new(K)",
+		`"cmp"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatal("missing from output", want, out)
+		}
+	}
+	if strings.Contains(out, "type Key") || strings.Contains(out, "type Value") {
+		t.Fatal("placeholders not removed", out)
+	}
+}
+
+func TestMonomorphize(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/generic/mono_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	if err = generic.Monomorphize(df, map[string]string{"Stack.T": "int"}); err != nil {
+		t.Fatal("Monomorphize", err)
+	}
+
+	var buf bytes.Buffer
+	if err = decorator.Fprint(&buf, df); err != nil {
+		t.Fatal("Fprint", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"type StackInt struct",
+		"type StackString struct",
+		"func (s *StackInt) Push(v int)",
+		"func (s *StackString) Top(n int) PairStringInt",
+		"type PairIntInt struct",
+		"return MakePairIntInt(s.items[len(s.items)-1], n)",
+		"return PairStringInt{First: a, Second: b}",
+		"var strings StackString",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatal("missing from output", want, out)
+		}
+	}
+	if strings.Contains(out, "[T") || strings.Contains(out, "[A") {
+		t.Fatal("type parameters left", out)
+	}
+
+	if err = generic.Monomorphize(df, map[string]string{"Stack.X": "int"}); err == nil {
+		t.Fatal("unknown type parameter should fail")
+	}
+}
+
+func TestRenameMembers(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/members/members_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	if err = globals.RenameMembers(df, map[string]string{"List.PushFront": "Prepend", "Linker.Next": "Succ"}, map[string]string{"Entry.next": "nxt"}); err != nil {
+		t.Fatal("RenameMembers", err)
+	}
+
+	var buf bytes.Buffer
+	if err = decorator.Fprint(&buf, df); err != nil {
+		t.Fatal("Fprint", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Succ() *Entry",
+		"\tnxt   *Entry",
+		"// Succ returns the entry after e\nfunc (e *Entry) Succ() *Entry {\n\treturn e.nxt",
+		"// Prepend inserts v at the front of l\nfunc (l *List) Prepend(v int) *Entry",
+		"&Entry{nxt: l.head, Value: v}",
+		"func (q *Queue) PushFront(v int)",
+		"push := l.Prepend",
+		"pushExpr := (*List).Prepend",
+		"q.PushFront(3)",
+		"_ = link.Succ()",
+		"_ = n.next",
+		"_ = l.head.nxt.Succ()",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatal("missing from output", want, out)
+		}
+	}
+
+	if err = globals.RenameMembers(df, map[string]string{"Queue.Pop": "Shift"}, nil); err == nil {
+		t.Fatal("unknown method should fail")
+	}
+	if err = globals.RenameMembers(df, nil, map[string]string{"Entry.nxt": "Value"}); err == nil {
+		t.Fatal("collision not reported")
+	}
+}
+
+func TestEmbeddedFields(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/embedded/embedded_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	embeds, err := globals.EmbeddedFields(df)
+	if err != nil {
+		t.Fatal("EmbeddedFields", err)
+	}
+	if len(embeds) != 3 {
+		t.Fatal("unexpected embedded fields", len(embeds))
+	}
+
+	renames := map[string]string{"Base": "pkg.Thing", "Node": "*Node", "Name": "Label"}
+	globals.RenameDecl(df, func(ident *dst.Ident, kind globals.SymKind) {
+		if name, ok := renames[ident.Name]; ok {
+			ident.Name = name
+		}
+	})
+	for _, e := range embeds {
+		e.Update()
+	}
+
+	var buf bytes.Buffer
+	if err = decorator.Fprint(&buf, df); err != nil {
+		t.Fatal("Fprint", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"\tpkg.Thing\n",
+		"\tNode  **Node\n",
+		"\tName  Label\n",
+		"Outer{Thing: pkg.Thing{ID: 1}, Node: new(*Node), Name: \"outer\"}",
+		"_ = o.Thing.ID",
+		"_ = o.Node.Next",
+		"_ = o.Name",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatal("missing from output", want, out)
+		}
+	}
+}
+
+func TestRemoveNodes(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/walk_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	specs := globals.TypeSpecs(df, []string{"GlobalType"})
+	methods := globals.MethodsOf(df, []string{"GlobalType"})
+	if len(specs) != 1 || len(methods) != 1 || methods[0].Name.Name != "Hello" {
+		t.Fatal("unexpected specs or methods", specs, methods)
+	}
+
+	// the replacement has the same name as another type, which must stay
+	globals.RenameDecl(df, func(ident *dst.Ident, kind globals.SymKind) {
+		if ident.Name == "GlobalType" {
+			ident.Name = "root"
+		}
+	})
+	globals.RemoveNodes(df, map[dst.Node]bool{specs[0]: true, methods[0]: true})
+
+	var buf bytes.Buffer
+	if err = decorator.Fprint(&buf, df); err != nil {
+		t.Fatal("Fprint", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "root struct {") || strings.Contains(out, ") Hello()") || strings.Count(out, "struct {") != 1 {
+		t.Fatal("unexpected output", out)
+	}
+}
+
+func TestGenericGlobals(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "data/generic/walk_test_data.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile", err)
+	}
+
+	df, err := decorator.DecorateFile(fset, f)
+	if err != nil {
+		t.Fatal("DecorateFile", err)
+	}
+
+	var globalNames []string
+	globals.WalkGlobalsDst(df, func(name string, kind globals.SymKind) bool {
+		globalNames = append(globalNames, name)
+		return true
+	})
+	if !reflect.DeepEqual(globalNames, []string{"T", "Number", "Sum", "Box", "Holder", "newHolder"}) {
+		t.Fatal("unexpected globals", globalNames)
+	}
+
+	renames := map[string]string{"T": "Unit", "Number": "Numeric", "Box": "Cell", "Sum": "Total"}
+	renamed := make(map[string]int)
+	globals.RenameDecl(df, func(ident *dst.Ident, kind globals.SymKind) {
+		if to, ok := renames[ident.Name]; ok {
+			renamed[ident.Name]++
+			ident.Name = to
+		}
+	})
+	// type parameters named T are not the global T
+	if !reflect.DeepEqual(renamed, map[string]int{"T": 5, "Number": 2, "Box": 4, "Sum": 2}) {
+		t.Fatal("unexpected renames", renamed)
+	}
+
+	commented := make(map[string]bool)
+	globals.UpdateComment(df, func(name string, node dst.Node) {
+		commented[name] = len(node.Decorations().Start) > 0
+	})
+	if !commented["Cell"] || !commented["Total"] || commented["newHolder"] {
+		t.Fatal("unexpected comments", commented)
+	}
+
+	globals.RemoveDecl(df, []string{"Total"})
+
+	var buf bytes.Buffer
+	if err = decorator.Fprint(&buf, df); err != nil {
+		t.Fatal("Fprint", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"type Unit struct{}",
+		"type Cell[T any] struct",
+		"func (b Cell[T]) Get() T",
+		"t   Unit",
+		"box Cell[Unit]",
+		"Cell[Unit]{v: Unit{}}",
+		"sum: Total[int]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatal("missing from output", want, out)
+		}
+	}
+	if strings.Contains(out, "func Total") {
+		t.Fatal("Total not removed", out)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zhiqiangxu/gg/pkg/check"
+	"github.com/zhiqiangxu/gg/pkg/generic"
+)
+
+var (
+	// ErrNotGeneric when a template has constructs which can't be expressed with generics
+	ErrNotGeneric = errors.New("template can't be converted into generics")
+)
+
+// togenericCommand implements `gg togeneric -t Type[=T] -i file [-o file]`, which converts a template
+// into Go generics with each placeholder type as a type parameter
+func togenericCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("togeneric", flag.ExitOnError)
+	var inputs, placeholders sliceValue
+	fs.Var(&inputs, "i", "template `file`, can be repeated for a template of multiple files")
+	fs.Var(&placeholders, "t", "placeholder `type` to become a type parameter, e.g. Type or Type=T, can be repeated")
+	output := fs.String("o", "", "output `file`, stdout if empty")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s togeneric [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if len(inputs) == 0 || len(placeholders) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	pt, err := parseTemplate(inputs)
+	if err != nil {
+		return
+	}
+	df, templatePos := pt.clone()
+	problems, err := generic.Convert(df, typeParams(placeholders))
+	if err != nil {
+		return
+	}
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool {
+			pi, pj := templatePos(problems[i].Node), templatePos(problems[j].Node)
+			if pi.Filename != pj.Filename {
+				return pi.Filename < pj.Filename
+			}
+			return pi.Offset < pj.Offset
+		})
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", templatePos(p.Node), p.Msg)
+		}
+		err = fmt.Errorf("%v: %d problems", ErrNotGeneric, len(problems))
+		return
+	}
+
+	// what is valid in the template may not be with type parameters, e.g. a string used as a T
+	errs, err := check.File(df, "", templatePos)
+	if err != nil {
+		return
+	}
+	if len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		err = fmt.Errorf("%v: %d type errors", ErrNotGeneric, len(errs))
+		return
+	}
+
+	content, err := formatFile("", df)
+	if err != nil {
+		return
+	}
+	return writeFile(*output, content)
+}
+
+// typeParams returns the type parameters for placeholders, the name defaults to the first letter
+// of the placeholder, or the placeholder itself if the first letter is taken by another one
+func typeParams(placeholders []string) (params []generic.Param) {
+	initials := make(map[string]int)
+	for _, p := range placeholders {
+		if !strings.Contains(p, "=") {
+			initials[initial(p)]++
+		}
+	}
+	for _, p := range placeholders {
+		if sep := strings.Index(p, "="); sep != -1 {
+			params = append(params, generic.Param{Placeholder: p[:sep], Name: p[sep+1:]})
+			continue
+		}
+		name := initial(p)
+		if initials[name] > 1 {
+			name = p
+		}
+		params = append(params, generic.Param{Placeholder: p, Name: name})
+	}
+	return
+}
+
+func initial(s string) string {
+	r, _ := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r))
+}
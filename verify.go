@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+)
+
+const (
+	// statusOK when the file is what would be generated now
+	statusOK = "ok"
+	// statusTemplateChanged when the template differs from the one recorded in the header
+	statusTemplateChanged = "template changed"
+	// statusEdited when the template is unchanged but the file differs from what would be generated
+	statusEdited = "hand-edited"
+	// statusError when the file can't be generated again
+	statusError = "error"
+)
+
+var (
+	// ErrVerify when some generated files are not up to date
+	ErrVerify = errors.New("verify failed")
+)
+
+// verifyResult is the state of one gg generated file
+type verifyResult struct {
+	File      string   `json:"file"`
+	Status    string   `json:"status"`
+	Templates []string `json:"templates,omitempty"`
+	Detail    string   `json:"detail,omitempty"`
+}
+
+// verifyCommand implements `gg verify [-json] [dir|dir/...]`, which finds gg generated files
+// and reports those whose template changed or which were edited by hand
+func verifyCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the results as json")
+	all := fs.Bool("all", false, "also list files that are up to date")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s verify [options] [dir|dir/...]...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	files, err := goFiles(patterns)
+	if err != nil {
+		return
+	}
+
+	var (
+		results []verifyResult
+		stale   int
+	)
+	for _, file := range files {
+		r, ok := verifyFile(file)
+		if !ok {
+			continue
+		}
+		if r.Status != statusOK {
+			stale++
+		} else if !*all {
+			continue
+		}
+		results = append(results, r)
+	}
+
+	if *asJSON {
+		if results == nil {
+			results = []verifyResult{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(results); err != nil {
+			return
+		}
+	} else if len(results) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tSTATUS\tDETAIL")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.File, r.Status, r.Detail)
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+
+	if stale > 0 {
+		err = fmt.Errorf("%v: %d stale files", ErrVerify, stale)
+	}
+	return
+}
+
+// verifyFile checks a file against its generation header, ok is false if it's not generated by gg
+func verifyFile(path string) (r verifyResult, ok bool) {
+	h, err := readHeader(path)
+	if err == ErrNoHeader {
+		return
+	}
+	ok = true
+	r.File = path
+	if err != nil {
+		r.Status, r.Detail = statusError, err.Error()
+		return
+	}
+
+	inst, err := headerInstance(path, h)
+	if err != nil {
+		r.Status, r.Detail = statusError, err.Error()
+		return
+	}
+	if err = resolveInputs(inst); err != nil {
+		r.Status, r.Detail = statusError, err.Error()
+		return
+	}
+	r.Templates = templateInputs(inst)
+
+	hash, err := templateHash(r.Templates)
+	if err != nil {
+		r.Status, r.Detail = statusError, err.Error()
+		return
+	}
+	if hash != h.Hash {
+		r.Status, r.Detail = statusTemplateChanged, "template modified since generation, run gg regen "+path
+		return
+	}
+
+	files, err := renderAll(inst)
+	if err != nil {
+		r.Status, r.Detail = statusError, err.Error()
+		return
+	}
+	var content []byte
+	for _, file := range files {
+		if file.Path == path {
+			content = file.Content
+		}
+	}
+	old, err := ioutil.ReadFile(path)
+	if err != nil {
+		r.Status, r.Detail = statusError, err.Error()
+		return
+	}
+	if !bytes.Equal(old, content) {
+		r.Status, r.Detail = statusEdited, "differs from what the template generates, run gg regen "+path
+		return
+	}
+
+	r.Status = statusOK
+	return
+}